@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -27,6 +28,15 @@ const configFile = "./config.ini"
 var crawlers map[int]*crawler.Service
 
 func main() {
+	resume := flag.String("resume", "", "Checkpoint key of the interrupted scan to resume (see the state directory)")
+	dir := flag.String("dir", "", "Scan a local directory (e.g. static site build output), save the report and exit")
+	baseURL := flag.String("base", "", "Base URL the directory given by -dir is published at")
+	flag.Parse()
+
+	if *dir != "" {
+		os.Exit(scanDir(*dir, *baseURL))
+	}
+
 	// Set lock
 	lock := lock()
 	defer func() {
@@ -43,6 +53,35 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to parse gcfg data: %s", err)
 	}
+	if err := crawler.CheckRules(&cfg); err != nil {
+		log.Fatalf("Invalid link classification rules: %s", err)
+	}
+	if err := crawler.CheckRetryClasses(&cfg); err != nil {
+		log.Fatalf("Invalid retry settings: %s", err)
+	}
+	if err := crawler.CheckMethods(&cfg); err != nil {
+		log.Fatalf("Invalid request method settings: %s", err)
+	}
+	if err := crawler.CheckHTTP(&cfg); err != nil {
+		log.Fatalf("Invalid HTTP settings: %s", err)
+	}
+	if err := crawler.CheckCredentials(&cfg); err != nil {
+		log.Fatalf("Invalid credentials: %s", err)
+	}
+	for schedName, sched := range cfg.Schedule {
+		if err := crawler.CheckScope(*sched); err != nil {
+			log.Fatalf("Invalid scope of schedule %q: %s", schedName, err)
+		}
+		if err := crawler.CheckCookies(*sched); err != nil {
+			log.Fatalf("Invalid cookie settings of schedule %q: %s", schedName, err)
+		}
+		if err := crawler.CheckOverrides(*sched); err != nil {
+			log.Fatalf("Invalid resolve or rewrite settings of schedule %q: %s", schedName, err)
+		}
+		if err := crawler.CheckFetcher(*sched); err != nil {
+			log.Fatalf("Invalid record or replay settings of schedule %q: %s", schedName, err)
+		}
+	}
 
 	logger := logger.New(os.Stdout, os.Stderr)
 
@@ -57,22 +96,29 @@ func main() {
 	var mx sync.Mutex
 	go processFinish(chReport, &cfg, &mx)
 
-	s := wsserver.New(logger, crawlers, router, a, cfg.Crawler.Delay, chReport)
+	s := wsserver.New(logger, crawlers, router, a, &cfg, chReport)
 	s.Endpoints()
 
 	api := api.New(logger, crawlers, router, a)
 	api.Endpoints()
 
+	if *resume != "" {
+		if _, err := s.Resume(*resume); err != nil {
+			log.Fatalf("Cannot resume scan %q: %v", *resume, err)
+		}
+	}
+
 	if len(cfg.Schedule) > 0 {
 		c := cron.New()
 		i := 1
 		for schedName, sched := range cfg.Schedule {
 			log.Printf("Schedule crawler process %q", schedName)
-			ID := i
+			ID, name, sched := i, schedName, sched
 			c.AddFunc(sched.Cron, func() {
-				crawlers[ID] = crawler.New(ID, cfg.Crawler.Delay, chReport, logger)
+				crawlers[ID] = crawler.New(ID, &cfg, chReport, logger)
+				crawlers[ID].Schedule = name
 				go s.PublishMessages(crawlers[ID].ChResults)
-				crawlers[ID].Scan(sched.URL, sched.Depth, sched.SessionName, sched.ExcludedURL)
+				crawlers[ID].Scan(*sched)
 			})
 			i++
 			if i >= 100 {
@@ -102,26 +148,9 @@ func main() {
 func processFinish(chReport chan *crawler.Service, cfg *conf.Config, mx *sync.Mutex) {
 	for {
 		s := <-chReport
-		data := report.JSONData{
-			TimeElapsed:  s.TimeElapsed,
-			TimeFinished: s.TimeFinished,
-			TotalLinks:   len(s.Processed),
-			URLs:         s.URLs,
-			Errors:       s.Errors,
-		}
+		data := reportData(s)
 		mx.Lock()
-		fileName, err := report.Save(&data)
-		if err != nil {
-			log.Printf("Report was not saved: %v", err)
-		} else {
-			log.Printf("Report saved in %s", fileName)
-		}
-		csvFileName, err := report.SaveCSV(&data)
-		if err != nil {
-			log.Printf("CSV report was not saved: %v", err)
-		} else {
-			log.Printf("CSV report saved in %s", csvFileName)
-		}
+		saveReport(cfg, &data)
 		if err := report.Send(cfg.SMTP, data); err != nil {
 			log.Printf("Report failed to send: %v", err)
 		} else {
@@ -137,6 +166,73 @@ func processFinish(chReport chan *crawler.Service, cfg *conf.Config, mx *sync.Mu
 	}
 }
 
+// reportData returns report data of the finished scan
+func reportData(s *crawler.Service) report.JSONData {
+	return report.JSONData{
+		TimeElapsed:  s.TimeElapsed,
+		TimeFinished: s.TimeFinished,
+		TotalLinks:   len(s.Processed),
+		URLs:         s.URLs,
+		Errors:       s.Errors,
+		Skipped:      s.Skipped,
+		Findings:     s.Findings,
+		Certificates: s.Certificates,
+		StopReason:   s.StopReason,
+	}
+}
+
+// saveReport saves the report in JSON and CSV files
+func saveReport(cfg *conf.Config, data *report.JSONData) {
+	fileName, err := report.Save(data)
+	if err != nil {
+		log.Printf("Report was not saved: %v", err)
+	} else {
+		log.Printf("Report saved in %s", fileName)
+	}
+	csvFileName, err := report.SaveCSV(data)
+	if err != nil {
+		log.Printf("CSV report was not saved: %v", err)
+	} else {
+		log.Printf("CSV report saved in %s", csvFileName)
+	}
+}
+
+// scanDir scans the directory published at baseURL without starting the server, saves the report
+// (and sends it if SMTP is configured) and returns the exit code: 1 if broken links are found.
+// The config file is optional in this mode
+func scanDir(dir, baseURL string) int {
+	var cfg conf.Config
+	if _, err := os.Stat(configFile); err == nil {
+		if err := gcfg.ReadFileInto(&cfg, configFile); err != nil {
+			log.Fatalf("Failed to parse gcfg data: %s", err)
+		}
+	}
+	sched := conf.ScheduleData{URL: []string{baseURL}, Depth: -1, Dir: dir}
+	if err := crawler.CheckFetcher(sched); err != nil {
+		log.Fatalf("Invalid directory scan: %s", err)
+	}
+
+	chReport := make(chan *crawler.Service, 1)
+	s := crawler.New(1, &cfg, chReport, logger.New(os.Stdout, os.Stderr))
+	go func() {
+		for range s.ChResults {
+		}
+	}()
+	s.Scan(sched)
+	data := reportData(<-chReport)
+	saveReport(&cfg, &data)
+	if cfg.SMTP.Addr != "" {
+		if err := report.Send(cfg.SMTP, data); err != nil {
+			log.Printf("Report failed to send: %v", err)
+		}
+	}
+	log.Printf("%d links checked, %d broken", data.TotalLinks, len(data.Errors))
+	if len(data.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
 // Sets the lockfile
 func lock() lockfile.Lockfile {
 	var curDir, err = os.Getwd()
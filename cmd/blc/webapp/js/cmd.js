@@ -12,13 +12,41 @@ function sendCommand(event) {
         'Cmd': cmd,
         'URLs': [],
         'Depth': -1,
+        'Workers': 0,
+        'Sitemap': false,
+        'CheckFragments': false,
+        'Soft404': false,
+        'MaxErrors': 0,
+        'MaxPages': 0,
+        'MaxPagesPerHost': 0,
+        'MaxDuration': 0,
+        'MaxBytes': 0,
+        'Include': [],
+        'Exclude': [],
     }
     if ('start' == cmd) {
         data.URLs = document.getElementById('urls').value.split("\n");
         data.Depth = parseInt(document.getElementById('depthInput').value);
+        data.Workers = parseInt(document.getElementById('workersInput').value) || 0;
+        data.Sitemap = document.getElementById('sitemapInput').checked;
+        data.CheckFragments = document.getElementById('fragmentsInput').checked;
+        data.Soft404 = document.getElementById('soft404Input').checked;
+        data.MaxErrors = parseInt(document.getElementById('maxErrorsInput').value) || 0;
+        data.MaxPages = parseInt(document.getElementById('maxPagesInput').value) || 0;
+        data.MaxPagesPerHost = parseInt(document.getElementById('maxPagesPerHostInput').value) || 0;
+        // Duration is entered in minutes, download size in megabytes
+        data.MaxDuration = Math.round((parseFloat(document.getElementById('maxDurationInput').value) || 0) * 60);
+        data.MaxBytes = Math.round((parseFloat(document.getElementById('maxBytesInput').value) || 0) * 1024 * 1024);
+        data.Include = patterns('includeInput');
+        data.Exclude = patterns('excludeInput');
         document.getElementById('startProcessAction').click();
     } else {
         data.ID = parseInt(event.target.dataset.pid);
     }
     cmdConn.send(JSON.stringify(data));
 }
+
+// patterns returns non-empty lines of the textarea with scope patterns
+function patterns(id) {
+    return document.getElementById(id).value.split("\n").map(p => p.trim()).filter(p => p != '');
+}
@@ -89,6 +89,10 @@ var handleMessage = function (event) {
     errClass = 'link-danger';
     if (obj.State == 1) {
         errClass = '';
+    } else if (obj.Skipped) {
+        errClass = 'text-muted';
+    } else if (obj.Finding) {
+        errClass = 'text-warning';
     } else {
         // Add error message
         let errBlock = document.getElementById("errors-" + obj.ID);
@@ -96,8 +100,8 @@ var handleMessage = function (event) {
             errBlock.getElementsByTagName('tbody')[0].innerHTML += '<tr class="process-id-' + obj.ID + '">' +
                 '<td class="text-break"><a href="' + obj.URL + '">' + obj.URL + '</a></td>' +
                 '<td class="text-break">' + obj.HTTPStatus + '</td>' +
-                '<td class="text-break">' + obj.Error + '</td>' +
-                '<td class="text-break"><a href="obj.ParentURL">' + obj.ParentURL + '</a></td>' +
+                '<td class="text-break">' + errorText(obj) + '</td>' +
+                '<td class="text-break">' + parentText(obj) + '</td>' +
                 '</tr>';
             if (errBlock.style.display == 'none') {
                 errBlock.style.display = 'block';
@@ -114,6 +118,73 @@ var handleMessage = function (event) {
     }
 }
 
+// Number of pages the broken link was found on shown in the table
+const maxParents = 10;
+
+// parentText returns links to the pages the broken link was found on with the position, element and text of the link,
+// e.g. "https://example.com/, line 12, column 5 (a href, nofollow): Contact us"
+function parentText(err) {
+    let parents = err.Parents && err.Parents.length ? err.Parents : [err];
+    let lines = parents.slice(0, maxParents).map(function (ref) {
+        let text = '<a href="' + ref.ParentURL + '">' + ref.ParentURL + '</a>';
+        if (ref.Line && ref.Column) {
+            text += ', line ' + ref.Line + ', column ' + ref.Column;
+        } else if (ref.Line) {
+            text += ', line ' + ref.Line;
+        } else if (ref.Page) {
+            text += ', page ' + ref.Page;
+        }
+        let details = [];
+        if (ref.Tag && ref.Attr) {
+            details.push(ref.Tag + ' ' + ref.Attr);
+        }
+        if (ref.Nofollow) {
+            details.push('nofollow');
+        }
+        if (details.length) {
+            text += ' (' + details.join(', ') + ')';
+        }
+        if (ref.Text) {
+            text += ': ' + escapeHTML(ref.Text);
+        }
+        return text;
+    });
+    if (parents.length > maxParents) {
+        lines.push('and ' + (parents.length - maxParents) + ' more');
+    }
+    return lines.join('<br />');
+}
+
+// escapeHTML escapes text taken from the scanned pages before it is inserted into the table
+function escapeHTML(text) {
+    let div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// errorText returns error message prefixed with the kind of the broken link, e.g. "Broken background image: 404 Not Found",
+// the retry summary ("failed 3/3 attempts") and the redirect chain if the link was redirected
+function errorText(err) {
+    let text = err.Error;
+    if (err.Kind) {
+        text = 'Broken ' + err.Kind + ': ' + text;
+    }
+    if (err.Retry) {
+        text += ' (' + err.Retry + ')';
+    }
+    if (err.Method) {
+        text += ' [' + err.Method + ']';
+    }
+    if (err.Redirects && err.Redirects.length) {
+        let steps = err.Redirects.map(r => r.URL + ' (' + r.HTTPStatus + ')');
+        if (err.FinalURL) {
+            steps.push(err.FinalURL);
+        }
+        text += '<br />Redirects: ' + steps.join(' -> ');
+    }
+    return text;
+}
+
 function loadErrors(id) {
     let xhr = new XMLHttpRequest();
     xhr.open('POST', '/api/processerrors/' + id + '/' + authToken);
@@ -134,8 +205,8 @@ function loadErrors(id) {
                     errBlock.getElementsByTagName('tbody')[0].innerHTML += '<tr class="process-id-' + id + '">' +
                         '<td class="text-break"><a href="' + url + '">' + url + '</a></td>' +
                         '<td class="text-break">' + data[url].HTTPStatus + '</td>' +
-                        '<td class="text-break">' + data[url].Error + '</td>' +
-                        '<td class="text-break"><a href="' + data[url].ParentURL + '">' + data[url].ParentURL + '</a></td>' +
+                        '<td class="text-break">' + errorText(data[url]) + '</td>' +
+                        '<td class="text-break">' + parentText(data[url]) + '</td>' +
                         '</tr>';
                     if (errBlock.style.display == 'none') {
                         errBlock.style.display = 'block';
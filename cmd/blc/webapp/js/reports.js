@@ -82,6 +82,9 @@ function loadReport(event) {
             let keys = Object.keys(repErrors);
             reportBlock.getElementsByClassName('total')[0].innerHTML = 'Total links processed: ' + data.TotalLinks;
             reportBlock.getElementsByClassName('total-errors')[0].innerHTML = 'Total errors: ' + keys.length;
+            if (data.StopReason) {
+                reportBlock.getElementsByClassName('total-errors')[0].innerHTML += '<br>Scan stopped early: ' + data.StopReason;
+            }
             if (data.URLs) {
                 reportBlock.getElementsByClassName('urls-list')[0].innerHTML = '<li>' + data.URLs.join('</li><li>') + '</li>';
             }
@@ -91,8 +94,8 @@ function loadReport(event) {
                     errBlock.getElementsByTagName('tbody')[0].innerHTML += '<tr>' +
                         '<td class="text-break"><a href="' + url + '">' + url + '</a></td>' +
                         '<td class="text-break">' + repErrors[url].HTTPStatus + '</td>' +
-                        '<td class="text-break">' + repErrors[url].Error + '</td>' +
-                        '<td class="text-break"><a href="' + repErrors[url].ParentURL + '">' + repErrors[url].ParentURL + '</a></td>' +
+                        '<td class="text-break">' + errorText(repErrors[url]) + '</td>' +
+                        '<td class="text-break">' + parentText(repErrors[url]) + '</td>' +
                         '</tr>';
                 }
             } else {
@@ -146,7 +146,7 @@ func (s *Service) processErrorsHandler(w http.ResponseWriter, r *http.Request) {
 		s.logger.Error(fmt.Sprintf("Process with specified ID (%v) not found", vars["id"]))
 		http.Error(w, "Process with specified ID not found", http.StatusInternalServerError)
 	}
-	encoded, err := json.Marshal(crw.Errors)
+	encoded, err := json.Marshal(crw.CurrentErrors())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -6,6 +6,7 @@ type Config struct {
 		Addr string
 	}
 	Crawler
+	HTTP
 	Auth struct {
 		Userslist string
 	}
@@ -14,11 +15,183 @@ type Config struct {
 		MaxReportsToStore int
 	}
 	Schedule map[string]*ScheduleData
+	Host     map[string]*Host
+	Rule     map[string]*Rule
+	Retry    map[string]*Retry
+	Normalize
+	Credentials map[string]*Credentials
 }
 
 // Crawler config
 type Crawler struct {
+	// Delay between requests to the same host, ms (used if RequestsPerSecond is not set)
 	Delay int
+	// Number of concurrent fetchers
+	Workers int
+	// Max number of links waiting in the queue (0 - default, -1 - no limit), links found when the queue is full
+	// are reported as skipped and not followed
+	MaxQueue int
+	// Max requests per second to the same host
+	RequestsPerSecond float64
+	// Max concurrent requests to the same host
+	MaxInFlightPerHost int
+	// Max pause requested by Retry-After header (429/503 responses) to wait for, sec
+	MaxRetryAfter int
+	// User-agent product token to look up rules in robots.txt (matched exactly, case-insensitive)
+	RobotsUserAgent string
+	// Max number of redirects to follow
+	MaxRedirects int
+	// Redirect chains of this number of hops or longer are reported
+	LongRedirectChain int
+	// Do not report permanent (301/308) redirects
+	IgnorePermanentRedirects bool
+	// Do not report redirects to another domain
+	IgnoreCrossDomainRedirects bool
+	// Scan is stopped when the number of broken links exceeds this budget (0 - default, -1 - no limit)
+	MaxErrors int
+	// Error classes to retry: dns, reset, timeout, 5xx, 429 (all if empty)
+	RetryOn []string
+	// Max number of attempts per request, including the first one (can be overridden per error class in Retry sections)
+	RetryAttempts int
+	// Pause before the first retry, doubled on each next retry (with random jitter), ms
+	RetryBackoff int
+	// Max pause between retries, ms
+	RetryMaxBackoff int
+	// Directory for the state files of running scans, used to resume interrupted scans
+	StateDir string
+	// Interval between saving the scan state, sec (0 - default, -1 - do not save)
+	CheckpointInterval int
+	// Crawl trap limits (0 - default, -1 - no limit): internal links exceeding them are reported
+	// and only checked, links on their pages are not followed.
+	// Max number of occurrences of a path segment (default 3)
+	MaxSegmentRepeats int
+	// Max number of path segments (default 20)
+	MaxPathSegments int
+	// Max number of distinct query strings of a path (default 100)
+	MaxQueryVariants int
+	// Max URL length (default 2048)
+	MaxURLLength int
+	// Statuses or ranges of HEAD responses after which the link is requested with GET (default: 400, 403, 404, 405, 501)
+	HeadFallback []string
+	// Method for links that are not HTML pages by extension: head (default) or get (only the beginning of the file is read)
+	NonHTMLMethod string
+	// Max number of body bytes read by GET requests of links that are not HTML pages (default 65536)
+	MaxNonHTMLBody int
+	// Soft 404 detection (enabled per schedule): pages containing one of these phrases (case-insensitive)
+	// or similar to the page a host returns for a random URL with a score of Soft404Threshold or more (0..1, default 0.85)
+	Soft404Phrase    []string
+	Soft404Threshold float64
+}
+
+// HTTP client config
+type HTTP struct {
+	// Timeouts, sec (0 - default, -1 - no limit): total request time including reading the body (default 15),
+	// connection establishment (default 10), TLS handshake (default 10) and waiting for response headers (no limit by default)
+	Timeout               int
+	ConnectTimeout        int
+	TLSHandshakeTimeout   int
+	ResponseHeaderTimeout int
+	// Verify TLS certificates (not verified by default)
+	VerifyTLS bool
+	// PEM file with extra CA certificates, added to the system pool
+	CAFile string
+	// Proxy URL: http://, https:// or socks5:// (HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables if empty)
+	Proxy string
+	// Max idle connections kept open per host (default 8)
+	MaxIdleConnsPerHost int
+	// Use HTTP/1.1 only
+	DisableHTTP2 bool
+	// Report certificates expiring within this number of days (0 - default 30, -1 - do not report)
+	CertExpiryDays int
+	// Host address overrides like curl --resolve: "host:port:address", port "*" matches any port.
+	// Connections go to the address while URLs, the Host header and the TLS server name keep the host name
+	Resolve []string
+	// URL rewrite rules "from to": URLs starting with the from prefix are fetched from the to prefix instead,
+	// reports keep the original URLs
+	Rewrite []string
+}
+
+// Host config overrides crawler settings for a single host
+type Host struct {
+	RequestsPerSecond float64
+	MaxInFlight       int
+	// Request all links of the host with this method: GET or HEAD
+	Method string
+}
+
+// Retry config overrides the retry settings of the Crawler section for a single error class
+// (dns, reset, timeout, 5xx or 429), 0 - use the Crawler setting
+type Retry struct {
+	// Max number of attempts per request, including the first one
+	Attempts int
+	// Pause before the first retry, doubled on each next retry (with random jitter), ms
+	Backoff int
+	// Max pause between retries, ms
+	MaxBackoff int
+}
+
+// Rule classifies links that match all of its conditions (empty conditions match any link)
+type Rule struct {
+	// Rules are checked in ascending order (rules with equal order - by name), the first matching rule wins
+	Order int
+	// Status codes or ranges: "404", "500-599"; 0 matches network errors
+	Status []string
+	// Response headers: "Name" (header is present) or "Name: value"
+	Header []string
+	// Host names, "*.example.com" also matches subdomains
+	Host []string
+	// Regular expressions to match the URL
+	URL []string
+	// ok, warning, broken or ignored
+	Outcome string
+	// Message for reports (response status if empty)
+	Message string
+}
+
+// Normalize configures URL canonicalization: links with the same canonical form are fetched once
+type Normalize struct {
+	// Trailing slash policy: keep (default), add or remove
+	TrailingSlash string
+	// Keep :80 and :443 ports in http and https URLs
+	KeepDefaultPort bool
+	// Keep host name case
+	KeepHostCase bool
+	// Keep percent-encoding as is (by default unreserved characters are decoded and escapes are upper-cased)
+	KeepEncoding bool
+	// Keep query parameters order (by default parameters are sorted by name)
+	KeepQueryOrder bool
+	// Lower-case the path (for case-insensitive servers)
+	FoldPathCase bool
+	// Query parameters to strip, "utm_*" matches a prefix, "-" disables stripping.
+	// Default: utm_*, fbclid, gclid, yclid, msclkid, _openstat
+	StripParam []string
+}
+
+// Credentials configure authentication on the scanned sites, schedules refer to them by name.
+// Secrets are not stored in the config: Username, Password, Header and Field values may refer to
+// environment variables as ${env:NAME} and to files as ${file:/path} (trailing newline is trimmed),
+// Password and Header values must contain such a reference
+type Credentials struct {
+	// form (POST a login form and keep session cookies), basic (HTTP Basic auth) or header (only static headers)
+	Type string
+	// Host names the credentials are sent to, "*.example.com" also matches subdomains (hosts of the schedule URLs if empty)
+	Host     []string
+	Username string
+	Password string
+	// Request headers: "Name: value"
+	Header []string
+	// Form login: URL to POST the form to, names of the username and password fields (default username and password)
+	// and extra form fields "name=value"
+	LoginURL      string
+	UsernameField string
+	PasswordField string
+	Field         []string
+	// The session is lost (the crawler logs in again and repeats the request) when a response has one of these
+	// statuses or ranges (default 401) or its final URL matches LoggedOutURL regexp (default: redirect to LoginURL)
+	LoggedOutStatus []string
+	LoggedOutURL    string
+	// Regexps of links that are not requested to keep the session (e.g. logout links)
+	LogoutURL []string
 }
 
 // SMTP config
@@ -40,4 +213,48 @@ type ScheduleData struct {
 	Cron        string
 	SessionName string
 	ExcludedURL []string
+	// Scope patterns: [host:|path:|query:|url:][re:]pattern, glob with "*" wildcard unless prefixed with "re:".
+	// Include limits internal links only, Exclude applies to all links
+	Include []string
+	Exclude []string
+	// Do not check robots.txt (e.g. for our own sites)
+	IgnoreRobots bool
+	// Seed the scan with URLs from sitemap
+	Sitemap bool
+	// Sitemap (or sitemap index) URLs, discovered from robots.txt or /sitemap.xml if empty
+	SitemapURL []string
+	// Check that pages have anchors for links with fragments (page.html#section)
+	CheckFragments bool
+	// Report pages answering 200 with a not-found template as soft 404
+	Soft404 bool
+	// Error budget of the scan, overrides Crawler.MaxErrors if not 0
+	MaxErrors int
+	// Scan budgets (0 - no limit): when one is exhausted the scan stops with a partial report.
+	// Max number of URLs fetched
+	MaxPages int
+	// Max number of URLs fetched from one host, further links to the host are skipped
+	MaxPagesPerHost int
+	// Max scan duration, sec
+	MaxDuration int
+	// Max total size of downloaded response bodies, bytes
+	MaxBytes int64
+	// Names of Credentials sections used to authenticate on the sites
+	Credentials []string
+	// Cookies: session (default, only the SessionName cookie is kept), jar (all cookies) or none
+	Cookies string
+	// Netscape cookies.txt file to seed the cookie jar with
+	CookieFile string
+	// Save the cookie jar to CookieFile after the scan, so the next run of the schedule continues with these cookies
+	SaveCookies bool
+	// Host address overrides and URL rewrite rules of this scan, see HTTP.Resolve and HTTP.Rewrite.
+	// They take precedence over the HTTP ones
+	Resolve []string
+	Rewrite []string
+	// Local directory (e.g. static site build output) served for the first URL: links under it are checked
+	// against files, other links are fetched over HTTP
+	Dir string
+	// Record all requests of the scan to this HAR archive
+	Record string
+	// Replay the scan from this HAR archive without network access, requests missing in the archive fail
+	Replay string
 }
@@ -0,0 +1,406 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"blc/pkg/conf"
+)
+
+// Способы авторизации
+const (
+	// AuthForm - вход через форму, сессия хранится в cookie
+	AuthForm = "form"
+	// AuthBasic - HTTP Basic авторизация
+	AuthBasic = "basic"
+	// AuthHeader - только заголовки запроса (например, токен)
+	AuthHeader = "header"
+)
+
+// SkippedLogout - ссылка завершила бы сессию
+const SkippedLogout = "logout link"
+
+// FindingAuth - не удалось войти на сайт
+const FindingAuth = "authentication"
+
+// Ссылки на секреты: ${env:NAME} и ${file:/path}
+var secretRef = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// Коды ответа, после которых сессия считается потерянной, по умолчанию
+var defaultLoggedOutStatus = []statusRange{{401, 401}}
+
+// Сколько раз за сканирование можно войти заново после потери сессии
+const maxRelogins = 20
+
+// credential это способ авторизации на хостах сканирования
+type credential struct {
+	name     string
+	kind     string
+	hosts    []string
+	username string
+	password string
+	headers  http.Header
+	// Вход через форму
+	loginURL        *url.URL
+	form            url.Values
+	loggedOutStatus []statusRange
+	loggedOutURL    *regexp.Regexp
+	logout          []*regexp.Regexp
+	// Мьютекс защищает состояние входа: номер текущей сессии (увеличивается при каждом входе),
+	// количество повторных входов и признак неудачного последнего входа
+	mux        sync.Mutex
+	generation int
+	relogins   int
+	failed     bool
+}
+
+// CheckCredentials проверяет способы авторизации из конфигурации и ссылки на них из расписаний
+func CheckCredentials(cfg *conf.Config) error {
+	for name := range cfg.Credentials {
+		if _, err := newCredentials(cfg.Credentials, []string{name}); err != nil {
+			return err
+		}
+	}
+	for name, sched := range cfg.Schedule {
+		if sched == nil {
+			continue
+		}
+		for _, c := range sched.Credentials {
+			if cfg.Credentials[c] == nil {
+				return fmt.Errorf("schedule %s: unknown credentials %q", name, c)
+			}
+		}
+	}
+	return nil
+}
+
+// newCredentials возвращает способы авторизации names из конфигурации, подставляя секреты
+func newCredentials(cfg map[string]*conf.Credentials, names []string) ([]*credential, error) {
+	creds := make([]*credential, 0, len(names))
+	for _, name := range names {
+		cc := cfg[name]
+		if cc == nil {
+			return nil, fmt.Errorf("unknown credentials %q", name)
+		}
+		c, err := newCredential(name, cc)
+		if err != nil {
+			return nil, fmt.Errorf("credentials %s: %v", name, err)
+		}
+		creds = append(creds, c)
+	}
+	return creds, nil
+}
+
+// newCredential возвращает способ авторизации name
+func newCredential(name string, cc *conf.Credentials) (*credential, error) {
+	c := credential{name: name, kind: strings.ToLower(cc.Type), headers: make(http.Header), form: make(url.Values)}
+	switch c.kind {
+	case AuthForm, AuthBasic, AuthHeader:
+	default:
+		return nil, fmt.Errorf("unknown type %q", cc.Type)
+	}
+	for _, h := range cc.Host {
+		c.hosts = append(c.hosts, strings.ToLower(strings.TrimSpace(h)))
+	}
+	var err error
+	if c.username, err = expandSecrets(cc.Username); err != nil {
+		return nil, err
+	}
+	if cc.Password != "" && !secretRef.MatchString(cc.Password) {
+		return nil, fmt.Errorf("password must be read from ${env:NAME} or ${file:/path}")
+	}
+	if c.password, err = expandSecrets(cc.Password); err != nil {
+		return nil, err
+	}
+	for _, h := range cc.Header {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid header %q", h)
+		}
+		if !secretRef.MatchString(parts[1]) {
+			return nil, fmt.Errorf("header %s value must be read from ${env:NAME} or ${file:/path}", strings.TrimSpace(parts[0]))
+		}
+		value, err := expandSecrets(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		c.headers.Add(strings.TrimSpace(parts[0]), value)
+	}
+	for _, re := range cc.LogoutURL {
+		r, err := regexp.Compile(re)
+		if err != nil {
+			return nil, fmt.Errorf("logout URL: %v", err)
+		}
+		c.logout = append(c.logout, r)
+	}
+	if c.kind == AuthBasic && c.username == "" {
+		return nil, fmt.Errorf("username is required for basic auth")
+	}
+	if c.kind != AuthForm {
+		return &c, nil
+	}
+
+	if cc.LoginURL == "" {
+		return nil, fmt.Errorf("login URL is required for form login")
+	}
+	if c.loginURL, err = url.Parse(cc.LoginURL); err != nil {
+		return nil, fmt.Errorf("login URL: %v", err)
+	}
+	if !c.loginURL.IsAbs() {
+		return nil, fmt.Errorf("login URL %s is not absolute", cc.LoginURL)
+	}
+	for _, f := range cc.Field {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid form field %q", f)
+		}
+		value, err := expandSecrets(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		c.form.Add(parts[0], value)
+	}
+	userField, passField := cc.UsernameField, cc.PasswordField
+	if userField == "" {
+		userField = "username"
+	}
+	if passField == "" {
+		passField = "password"
+	}
+	c.form.Set(userField, c.username)
+	c.form.Set(passField, c.password)
+	c.loggedOutStatus = defaultLoggedOutStatus
+	if len(cc.LoggedOutStatus) > 0 {
+		c.loggedOutStatus = nil
+		for _, st := range cc.LoggedOutStatus {
+			sr, err := parseStatusRange(st)
+			if err != nil {
+				return nil, fmt.Errorf("logged out status: %v", err)
+			}
+			c.loggedOutStatus = append(c.loggedOutStatus, sr)
+		}
+	}
+	if cc.LoggedOutURL != "" {
+		if c.loggedOutURL, err = regexp.Compile(cc.LoggedOutURL); err != nil {
+			return nil, fmt.Errorf("logged out URL: %v", err)
+		}
+	}
+	return &c, nil
+}
+
+// expandSecrets подставляет в значение секреты из переменных окружения и файлов
+func expandSecrets(value string) (string, error) {
+	var err error
+	result := secretRef.ReplaceAllStringFunc(value, func(ref string) string {
+		m := secretRef.FindStringSubmatch(ref)
+		switch m[1] {
+		case "env":
+			v, ok := os.LookupEnv(m[2])
+			if !ok && err == nil {
+				err = fmt.Errorf("environment variable %s is not set", m[2])
+			}
+			return v
+		default:
+			data, e := ioutil.ReadFile(m[2])
+			if e != nil && err == nil {
+				err = fmt.Errorf("secret file: %v", e)
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+	})
+	return result, err
+}
+
+// authHeaders возвращает имена заголовков, которые задают способы авторизации cfg
+func authHeaders(cfg map[string]*conf.Credentials) []string {
+	var names []string
+	for _, cc := range cfg {
+		if cc == nil {
+			continue
+		}
+		for _, h := range cc.Header {
+			if parts := strings.SplitN(h, ":", 2); len(parts) == 2 {
+				names = append(names, strings.TrimSpace(parts[0]))
+			}
+		}
+	}
+	return names
+}
+
+// samePage проверяет, что URL ведут на одну страницу (без учета строки запроса и фрагмента)
+func samePage(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.EscapedPath() == b.EscapedPath()
+}
+
+// loggedOut проверяет по ответу на запрос ссылки link, что сессия потеряна
+func (c *credential) loggedOut(link *url.URL, response *http.Response) bool {
+	if c.kind != AuthForm || samePage(link, c.loginURL) {
+		return false
+	}
+	for _, sr := range c.loggedOutStatus {
+		if response.StatusCode >= sr.from && response.StatusCode <= sr.to {
+			return true
+		}
+	}
+	final := response.Request.URL
+	if c.loggedOutURL != nil {
+		return c.loggedOutURL.MatchString(final.String())
+	}
+	return samePage(final, c.loginURL)
+}
+
+// setupAuth подготавливает авторизацию сканирования: для входа через форму клиент получает хранилище cookie
+// и выполняется вход. Продолженное сканирование не входит заново, если cookie для адреса входа восстановлены
+// из файла состояния: если сессия все же потеряна, вход выполнится при первом ответе о ее потере.
+// Ошибки входа попадают в замечания, сканирование продолжается без авторизации
+func (s *Service) setupAuth(names []string) {
+	creds, err := newCredentials(s.credentials, names)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Credentials are ignored, ID: %d: %v", s.ID, err))
+		s.addFinding(Finding{Category: FindingAuth, Message: fmt.Sprintf("Credentials are ignored: %v", err)})
+		return
+	}
+	s.auth = creds
+	for _, c := range creds {
+		if c.kind != AuthForm {
+			continue
+		}
+		// Для входа через форму нужны все cookie, независимо от режима сканирования
+		s.cookies.acceptOnly("")
+		s.client.Jar = s.cookies
+		if s.resumed && len(s.cookies.Cookies(c.loginURL)) > 0 {
+			continue
+		}
+		c.mux.Lock()
+		c.failed = !s.login(c, "")
+		c.mux.Unlock()
+	}
+}
+
+// credential возвращает способ авторизации для ссылки u или nil
+func (s *Service) credential(u *url.URL) *credential {
+	for _, c := range s.auth {
+		if len(c.hosts) == 0 && s.internal(u) || len(c.hosts) > 0 && matchHost(u, c.hosts) {
+			return c
+		}
+	}
+	return nil
+}
+
+// authorize добавляет в запрос данные авторизации. Возвращает способ авторизации и номер сессии,
+// с которой отправлен запрос (нужен для повторного входа)
+func (s *Service) authorize(request *http.Request) (*credential, int) {
+	c := s.credential(request.URL)
+	if c == nil {
+		return nil, 0
+	}
+	for name, values := range c.headers {
+		request.Header[name] = values
+	}
+	if c.kind == AuthBasic {
+		request.SetBasicAuth(c.username, c.password)
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c, c.generation
+}
+
+// checkRedirect проверяет перенаправление по политике перенаправлений. Если перенаправление ведет на адрес,
+// к которому способ авторизации исходного запроса не относится, его заголовки из запроса убираются
+func (s *Service) checkRedirect(request *http.Request, via []*http.Request) error {
+	if err := s.redirects.checkRedirect(request, via); err != nil {
+		return err
+	}
+	c := s.credential(via[0].URL)
+	if c == nil || s.credential(request.URL) == c {
+		return nil
+	}
+	for name := range c.headers {
+		request.Header.Del(name)
+	}
+	if c.kind == AuthBasic {
+		request.Header.Del("Authorization")
+	}
+	return nil
+}
+
+// login отправляет форму входа, cookie сессии сохраняются в хранилище клиента. held - хост, место которого
+// в ограничителе уже занято вызывающим обработчиком. Вызывается под мьютексом способа авторизации
+func (s *Service) login(c *credential, held string) bool {
+	c.generation++
+	request, err := http.NewRequest(http.MethodPost, c.loginURL.String(), strings.NewReader(c.form.Encode()))
+	if err != nil {
+		s.loginFailed(c, err.Error())
+		return false
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Add("User-Agent", userAgent)
+	for name, values := range c.headers {
+		request.Header[name] = values
+	}
+	release := s.limit(c.loginURL.Hostname(), held)
+	defer release()
+	response, err := s.client.Do(request)
+	if err != nil {
+		s.loginFailed(c, err.Error())
+		return false
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, maxCSSSize))
+	response.Body.Close()
+	if response.StatusCode >= 400 {
+		s.loginFailed(c, "login form returned "+response.Status)
+		return false
+	}
+	if c.loggedOutURL != nil && c.loggedOutURL.MatchString(response.Request.URL.String()) {
+		s.loginFailed(c, "redirected to "+response.Request.URL.String()+" after login")
+		return false
+	}
+	s.logger.Info(fmt.Sprintf("Logged in, ID: %d: %s", s.ID, c.name))
+	return true
+}
+
+// loginFailed сообщает о неудачном входе
+func (s *Service) loginFailed(c *credential, message string) {
+	s.logger.Error(fmt.Sprintf("Login failed, ID: %d: %s: %s", s.ID, c.name, message))
+	s.addFinding(Finding{Category: FindingAuth, URL: c.loginURL.String(), Message: "Login failed: " + message})
+}
+
+// relogin входит заново после потери сессии generation. Если другой обработчик уже вошел заново,
+// повторный вход не выполняется. После неудачного входа и сверх maxRelogins войти заново не пытается.
+// held - хост, место которого в ограничителе занято вызывающим обработчиком.
+// Возвращает false, если запрос повторять не нужно
+func (s *Service) relogin(c *credential, generation int, held string) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.generation != generation {
+		return !c.failed
+	}
+	if c.failed || c.relogins >= maxRelogins {
+		return false
+	}
+	c.relogins++
+	s.logger.Info(fmt.Sprintf("Session lost, ID: %d: %s, logging in again", s.ID, c.name))
+	c.failed = !s.login(c, held)
+	return !c.failed
+}
+
+// logoutLink проверяет, что запрос ссылки u завершил бы сессию
+func (s *Service) logoutLink(u *url.URL) bool {
+	c := s.credential(u)
+	if c == nil {
+		return false
+	}
+	for _, re := range c.logout {
+		if re.MatchString(u.String()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_auth(t *testing.T) {
+	var mu sync.Mutex
+	sessions := make(map[string]bool)
+	logins := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			fmt.Fprint(w, `<form method="post"><input name="login"><input name="pass" type="password"></form>`)
+			return
+		}
+		if r.FormValue("login") != "checker" || r.FormValue("pass") != "secret" || r.FormValue("remember") != "1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		logins++
+		sid := strconv.Itoa(logins)
+		sessions[sid] = true
+		mu.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: sid, Path: "/"})
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		c, err := r.Cookie("sid")
+		if err != nil || !sessions[c.Value] {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/expire">expire</a><a href="/page">page</a><a href="/logout">logout</a>`)
+		case "/expire":
+			// Сессия истекает
+			delete(sessions, c.Value)
+		case "/page":
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	// Сервер на другом хосте не должен получать заголовки авторизации после перенаправления
+	var leaked bool
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("X-Client") != "" || r.Header.Get("Authorization") != "" {
+			leaked = true
+		}
+	}))
+	defer other.Close()
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, otherURL+"/data.json", http.StatusFound)
+			return
+		}
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "api" || pass != "token" || r.Header.Get("X-Client") != "blc" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="%s/data.json">data</a><a href="%s/moved">moved</a>`, api.URL, api.URL)
+	})
+
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(secret, []byte("token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("BLC_TEST_PASSWORD", "secret")
+	defer os.Unsetenv("BLC_TEST_PASSWORD")
+	os.Setenv("BLC_TEST_CLIENT", "blc")
+	defer os.Unsetenv("BLC_TEST_CLIENT")
+	form := conf.Credentials{
+		Type:          AuthForm,
+		LoginURL:      ts.URL + "/login",
+		Username:      "checker",
+		Password:      "${env:BLC_TEST_PASSWORD}",
+		UsernameField: "login",
+		PasswordField: "pass",
+		Field:         []string{"remember=1"},
+		LogoutURL:     []string{"/logout$"},
+	}
+	basic := conf.Credentials{
+		Type:     AuthBasic,
+		Host:     []string{"127.0.0.1"},
+		Username: "api",
+		Password: "${file:" + secret + "}",
+		Header:   []string{"X-Client: ${env:BLC_TEST_CLIENT}"},
+	}
+	wrong := form
+	wrong.Field = nil
+
+	tests := []struct {
+		name   string
+		creds  map[string]*conf.Credentials
+		urls   []string
+		logins int
+		// Битые ссылки, пропущенные ссылки и категории замечаний
+		errors   []string
+		skipped  []string
+		findings []string
+	}{
+		{
+			name:    "form",
+			creds:   map[string]*conf.Credentials{"form": &form},
+			urls:    []string{ts.URL + "/"},
+			logins:  2,
+			skipped: []string{ts.URL + "/logout"},
+		},
+		{
+			name:     "basic",
+			creds:    map[string]*conf.Credentials{"basic": &basic},
+			urls:     []string{ts.URL + "/api"},
+			logins:   0,
+			findings: []string{FindingCrossDomainRedirect},
+		},
+		{
+			name:     "login failed",
+			creds:    map[string]*conf.Credentials{"form": &wrong},
+			urls:     []string{ts.URL + "/"},
+			logins:   0,
+			findings: []string{FindingAuth},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := conf.Config{Credentials: tt.creds}
+			if err := CheckCredentials(&cfg); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			logins = 0
+			leaked = false
+			mu.Unlock()
+			var names []string
+			for name := range tt.creds {
+				names = append(names, name)
+			}
+			s := runScan(t, &cfg, nil, conf.ScheduleData{URL: tt.urls, Depth: 3, IgnoreRobots: true, Credentials: names})
+
+			mu.Lock()
+			if logins != tt.logins {
+				t.Errorf("Logins: получено %d, ожидается %d", logins, tt.logins)
+			}
+			if leaked {
+				t.Error("Заголовки авторизации отправлены на другой хост после перенаправления")
+			}
+			mu.Unlock()
+			var errs, skipped, findings []string
+			for link := range s.Errors {
+				errs = append(errs, link)
+			}
+			for link, r := range s.Skipped {
+				if r.Reason == SkippedLogout {
+					skipped = append(skipped, link)
+				}
+			}
+			for _, f := range s.Findings {
+				findings = append(findings, f.Category)
+			}
+			if !reflect.DeepEqual(errs, tt.errors) {
+				t.Errorf("Errors: получено %v, ожидается %v", errs, tt.errors)
+			}
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("Skipped: получено %v, ожидается %v", skipped, tt.skipped)
+			}
+			if !reflect.DeepEqual(findings, tt.findings) {
+				t.Errorf("Findings: получено %v, ожидается %v", findings, tt.findings)
+			}
+		})
+	}
+
+	if err := CheckCredentials(&conf.Config{Credentials: map[string]*conf.Credentials{
+		"plain": {Type: AuthBasic, Username: "api", Password: "token"},
+	}}); err == nil {
+		t.Error("Password written in config is accepted")
+	}
+	if err := CheckCredentials(&conf.Config{Credentials: map[string]*conf.Credentials{
+		"plain": {Type: AuthHeader, Header: []string{"X-Api-Key: token"}},
+	}}); err == nil {
+		t.Error("Header value written in config is accepted")
+	}
+}
@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+// budget это ограничения сканирования и счетчики, по которым они проверяются
+type budget struct {
+	// Количество загруженных байт (изменяется атомарно, поле первое для выравнивания на 32-битных платформах)
+	bytes int64
+	// Ограничения, 0 - нет ограничения
+	maxPages        int
+	maxPagesPerHost int
+	maxDuration     time.Duration
+	maxBytes        int64
+	// Количество запрошенных ссылок, всего и по хостам (защищены мьютексом службы)
+	pages     int
+	hostPages map[string]int
+	// Время, проведенное на паузе, и начало текущей паузы (защищены мьютексом службы)
+	paused   time.Duration
+	pausedAt time.Time
+}
+
+// setLimits устанавливает ограничения из параметров сканирования, не сбрасывая счетчики
+func (b *budget) setLimits(sched conf.ScheduleData) {
+	b.maxPages = sched.MaxPages
+	b.maxPagesPerHost = sched.MaxPagesPerHost
+	b.maxDuration = time.Duration(sched.MaxDuration) * time.Second
+	b.maxBytes = sched.MaxBytes
+}
+
+// reserve учитывает запрос ссылки t с хоста host и отмечает ссылку запрошенной. Если бюджет страниц, ошибок, времени или трафика исчерпан,
+// сканирование останавливается, если исчерпан бюджет хоста, ссылка пропускается.
+// Возвращает false, если ссылку запрашивать нельзя
+func (s *Service) reserve(t task, host string) bool {
+	// Бюджеты проверяет и диспетчер, но раз в проход цикла: без этой проверки обработчики успевают
+	// начать новые запросы уже после исчерпания бюджета трафика
+	if reason := s.exhausted(); reason != "" {
+		s.stop(reason)
+		return false
+	}
+	s.mux.Lock()
+	b := s.budget
+	switch {
+	case b.maxPages > 0 && b.pages >= b.maxPages:
+		s.mux.Unlock()
+		s.stop(fmt.Sprintf("page budget exhausted: %d URLs fetched", b.maxPages))
+		return false
+	case b.maxPagesPerHost > 0 && b.hostPages[host] >= b.maxPagesPerHost:
+		s.mux.Unlock()
+		s.skip(t.link, SkipResult{Reason: SkippedByHostBudget, ParentURL: t.baseLink})
+		return false
+	}
+	b.pages++
+	b.hostPages[host]++
+	// Ссылка отмечается запрошенной под тем же мьютексом, чтобы в сохраненном состоянии бюджет страниц
+	// и список запрошенных ссылок совпадали
+	s.Processed[t.link] = true
+	s.visited[t.id()] = true
+	s.mux.Unlock()
+	return true
+}
+
+// exhausted проверяет бюджеты ошибок, времени и трафика. Возвращает причину остановки
+// или пустую строку, если сканирование можно продолжать
+func (s *Service) exhausted() string {
+	b := s.budget
+	switch {
+	case s.maxErrors >= 0 && s.errorsCount() > s.maxErrors:
+		return fmt.Sprintf("error budget exceeded: more than %d errors", s.maxErrors)
+	case b.maxDuration > 0 && s.activeTime() >= b.maxDuration:
+		return fmt.Sprintf("time budget exhausted: %v", b.maxDuration)
+	case b.maxBytes > 0 && atomic.LoadInt64(&b.bytes) >= b.maxBytes:
+		return fmt.Sprintf("byte budget exhausted: %d bytes downloaded", atomic.LoadInt64(&b.bytes))
+	}
+	return ""
+}
+
+// activeTime возвращает время сканирования без учета пауз
+func (s *Service) activeTime() time.Duration {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return time.Since(s.started) - s.pausedTime()
+}
+
+// pausedTime возвращает время, проведенное на паузе, включая текущую паузу. Вызывается под мьютексом службы
+func (s *Service) pausedTime() time.Duration {
+	b := s.budget
+	if b.pausedAt.IsZero() {
+		return b.paused
+	}
+	return b.paused + time.Since(b.pausedAt)
+}
+
+// stop останавливает сканирование по исчерпании бюджета. Отчет будет сформирован по уже проверенным ссылкам
+func (s *Service) stop(reason string) {
+	s.mux.Lock()
+	if s.currentState == STOPPED {
+		s.mux.Unlock()
+		return
+	}
+	s.currentState = STOPPED
+	s.StopReason = reason
+	s.mux.Unlock()
+	s.logger.Info(fmt.Sprintf("Stopped, ID: %d: %s", s.ID, reason))
+}
+
+// countingReader считает байты, прочитанные из тела ответа
+type countingReader struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
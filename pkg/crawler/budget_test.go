@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+	"blc/pkg/logger"
+)
+
+func TestService_budgets(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch {
+		case r.URL.Path == "/":
+			for i := 0; i < 10; i++ {
+				fmt.Fprintf(w, `<a href="/page-%d">%d</a>`, i, i)
+			}
+			fmt.Fprint(w, `<a href="/slow-0">slow</a>`)
+		case strings.HasPrefix(r.URL.Path, "/page-"):
+			fmt.Fprint(w, strings.Repeat("x", 10000))
+		case strings.HasPrefix(r.URL.Path, "/slow-"):
+			// Бесконечная цепочка медленных страниц
+			time.Sleep(100 * time.Millisecond)
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/slow-"))
+			fmt.Fprintf(w, `<a href="/slow-%d">next</a>`, n+1)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Ссылки, уже переданные обработчикам, проверяются и после исчерпания бюджета
+	tests := []struct {
+		name   string
+		sched  conf.ScheduleData
+		reason string
+		min    int
+		max    int
+	}{
+		{"pages", conf.ScheduleData{MaxPages: 5}, "page budget exhausted: 5 URLs fetched", 5, 5},
+		{"host", conf.ScheduleData{MaxPagesPerHost: 4}, "", 4, 4},
+		{"bytes", conf.ScheduleData{MaxBytes: 20000}, "byte budget exhausted", 3, 5},
+		{"duration", conf.ScheduleData{MaxDuration: 1}, "time budget exhausted: 1s", 5, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched := tt.sched
+			sched.URL = []string{ts.URL + "/"}
+			sched.Depth = -1
+			if tt.name != "duration" {
+				sched.ExcludedURL = []string{ts.URL + "/slow-0"}
+			}
+			s := runScan(t, &conf.Config{Crawler: conf.Crawler{Workers: 2}}, nil, sched)
+			if !strings.HasPrefix(s.StopReason, tt.reason) || (tt.reason == "") != (s.StopReason == "") {
+				t.Errorf("StopReason: получено %q, ожидается %q", s.StopReason, tt.reason)
+			}
+			if n := len(s.Processed); n < tt.min || n > tt.max {
+				t.Errorf("Processed: получено %d, ожидается от %d до %d", n, tt.min, tt.max)
+			}
+			if tt.name == "host" {
+				skipped := 0
+				for _, sk := range s.Skipped {
+					if sk.Reason == SkippedByHostBudget {
+						skipped++
+					}
+				}
+				if skipped != 7 {
+					t.Errorf("Skipped: получено %d, ожидается 7", skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestService_pausedDuration(t *testing.T) {
+	s := New(1, &conf.Config{}, make(chan *Service, 1), logger.New(ioutil.Discard, ioutil.Discard))
+	go func() {
+		for range s.ChResults {
+		}
+	}()
+	defer close(s.ChResults)
+	s.budget.setLimits(conf.ScheduleData{MaxDuration: 1})
+	s.setState(INPROGRESS)
+	s.started = time.Now().Add(-2 * time.Second)
+
+	// Сканирование шло полсекунды, остальное время стояло на паузе
+	s.Command("PAUSE")
+	s.budget.pausedAt = s.budget.pausedAt.Add(-1500 * time.Millisecond)
+	if reason := s.exhausted(); reason != "" {
+		t.Errorf("Время на паузе учтено в бюджете: %s", reason)
+	}
+	s.Command("PROCEED")
+	if d := s.activeTime(); d < 400*time.Millisecond || d > time.Second {
+		t.Errorf("activeTime: получено %v, ожидается около 500ms", d)
+	}
+	s.started = s.started.Add(-time.Second)
+	if reason := s.exhausted(); !strings.HasPrefix(reason, "time budget exhausted") {
+		t.Errorf("exhausted: получено %q, ожидается исчерпание бюджета времени", reason)
+	}
+}
@@ -0,0 +1,178 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+// Проблемы TLS-сертификатов
+const (
+	// CertExpired - срок действия сертификата истек
+	CertExpired = "expired certificate"
+	// CertExpiring - срок действия сертификата скоро истекает
+	CertExpiring = "certificate expires soon"
+	// CertHostname - сертификат выдан для другого имени хоста
+	CertHostname = "hostname mismatch"
+	// CertSelfSigned - самоподписанный сертификат
+	CertSelfSigned = "self-signed certificate"
+	// CertUntrusted - цепочка сертификатов не ведет к доверенному корневому сертификату
+	CertUntrusted = "untrusted certificate"
+	// CertWeakProtocol - устаревшая версия TLS
+	CertWeakProtocol = "weak TLS version"
+)
+
+// За сколько дней до окончания срока действия сертификата о нем сообщается по умолчанию
+const defaultCertExpiryDays = 30
+
+// CertificateIssue это проблема TLS-сертификата хоста
+type CertificateIssue struct {
+	Host     string
+	Category string
+	Message  string
+	Subject  string
+	Issuer   string
+	NotAfter time.Time
+	// URL, при запросе которого получен сертификат
+	URL string
+}
+
+// certAudit проверяет сертификаты хостов. Так как сертификаты при запросах не проверяются,
+// цепочка проверяется отдельно, один раз для каждого хоста
+type certAudit struct {
+	// Корневые сертификаты (nil - системные)
+	roots *x509.CertPool
+	// Срок, за который сообщается об окончании действия сертификата (отрицательный - не сообщается)
+	expiry time.Duration
+	mux    sync.Mutex
+	// Проверенные хосты
+	checked map[string]bool
+}
+
+// newCertAudit возвращает проверку сертификатов с корневыми сертификатами транспорта tr
+func newCertAudit(cfg conf.HTTP, tr http.RoundTripper) *certAudit {
+	a := certAudit{checked: make(map[string]bool)}
+	if f, ok := tr.(liveFetcher); ok {
+		tr = f.Transport
+	}
+	if t, ok := tr.(*http.Transport); ok && t.TLSClientConfig != nil {
+		a.roots = t.TLSClientConfig.RootCAs
+	}
+	days := cfg.CertExpiryDays
+	if days == 0 {
+		days = defaultCertExpiryDays
+	}
+	a.expiry = time.Duration(days) * 24 * time.Hour
+	return &a
+}
+
+// first отмечает хост проверенным. Возвращает false, если хост уже проверялся
+func (a *certAudit) first(host string) bool {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.checked[host] {
+		return false
+	}
+	a.checked[host] = true
+	return true
+}
+
+// check возвращает проблемы сертификата хоста host по состоянию TLS-соединения на момент now
+func (a *certAudit) check(host string, cs *tls.ConnectionState, now time.Time) []CertificateIssue {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := cs.PeerCertificates[0]
+	issue := func(category, message string) CertificateIssue {
+		return CertificateIssue{
+			Host:     host,
+			Category: category,
+			Message:  message,
+			Subject:  leaf.Subject.String(),
+			Issuer:   leaf.Issuer.String(),
+			NotAfter: leaf.NotAfter,
+		}
+	}
+	var issues []CertificateIssue
+
+	if cs.Version < tls.VersionTLS12 {
+		issues = append(issues, issue(CertWeakProtocol, tlsVersion(cs.Version)+" negotiated, TLS 1.2 or later is expected"))
+	}
+	expired := now.After(leaf.NotAfter)
+	switch {
+	case expired:
+		issues = append(issues, issue(CertExpired, "Expired on "+leaf.NotAfter.UTC().Format("2006-01-02")))
+	case a.expiry >= 0 && now.Add(a.expiry).After(leaf.NotAfter):
+		days := int(leaf.NotAfter.Sub(now).Hours() / 24)
+		issues = append(issues, issue(CertExpiring, fmt.Sprintf("Expires on %s (in %d days)", leaf.NotAfter.UTC().Format("2006-01-02"), days)))
+	}
+	hostname := host
+	if u, err := url.Parse("//" + host); err == nil {
+		hostname = u.Hostname()
+	}
+	// После замены URL соединение установлено с другим хостом, сертификат проверяется для него
+	if cs.ServerName != "" {
+		hostname = cs.ServerName
+	}
+	if err := leaf.VerifyHostname(hostname); err != nil {
+		issues = append(issues, issue(CertHostname, err.Error()))
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{Roots: a.roots, Intermediates: intermediates, CurrentTime: now})
+	var unknown x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired && expired:
+		// Уже отмечен как просроченный
+	case errors.As(err, &unknown) && len(cs.PeerCertificates) == 1 && leaf.CheckSignatureFrom(leaf) == nil:
+		issues = append(issues, issue(CertSelfSigned, "Certificate is signed by itself"))
+	default:
+		issues = append(issues, issue(CertUntrusted, err.Error()))
+	}
+	return issues
+}
+
+// tlsVersion возвращает название версии TLS
+func tlsVersion(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("TLS version 0x%04x", v)
+}
+
+// auditCertificates проверяет сертификат хоста, ответившего на запрос (с учетом перенаправлений), если он еще не проверялся
+func (s *Service) auditCertificates(response *http.Response) {
+	if response.TLS == nil || response.Request == nil {
+		return
+	}
+	host := response.Request.URL.Host
+	if !s.certs.first(host) {
+		return
+	}
+	for _, issue := range s.certs.check(host, response.TLS, time.Now()) {
+		issue.URL = response.Request.URL.String()
+		s.mux.Lock()
+		s.Certificates = append(s.Certificates, issue)
+		s.mux.Unlock()
+		s.publish(ScanResult{URL: issue.URL, Error: issue.Message, Finding: issue.Category})
+	}
+}
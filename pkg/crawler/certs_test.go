@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+// testCertificate возвращает сертификат, подписанный сертификатом parent (самоподписанный сертификат CA, если parent не задан)
+func testCertificate(t *testing.T, parent *tls.Certificate, notAfter time.Time, hosts ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "blc test"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else {
+			tpl.DNSNames = append(tpl.DNSNames, h)
+		}
+	}
+	issuer, signer := tpl, crypto.Signer(key)
+	if parent == nil {
+		tpl.IsCA, tpl.BasicConstraintsValid = true, true
+	} else {
+		issuer, signer = parent.Leaf, parent.PrivateKey.(crypto.Signer)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, issuer, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestService_certificates(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/page-1">1</a><a href="/page-2">2</a>`)
+		}
+	})
+	now := time.Now()
+	ca := testCertificate(t, nil, now.Add(365*24*time.Hour), "blc test CA")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	valid := testCertificate(t, &ca, now.Add(365*24*time.Hour), "127.0.0.1")
+	expired := testCertificate(t, &ca, now.Add(-24*time.Hour), "other.example")
+	expiring := testCertificate(t, &ca, now.Add(10*24*time.Hour), "127.0.0.1")
+
+	tests := []struct {
+		name string
+		// Сертификат сервера (nil - самоподписанный сертификат httptest)
+		cert   *tls.Certificate
+		caFile string
+		// Максимальная версия TLS сервера
+		maxVersion uint16
+		want       []string
+	}{
+		{"valid", &valid, caFile, 0, []string{}},
+		{"self-signed", nil, caFile, 0, []string{CertSelfSigned}},
+		{"untrusted", &valid, "", 0, []string{CertUntrusted}},
+		{"expired", &expired, caFile, 0, []string{CertExpired, CertHostname}},
+		{"expiring", &expiring, caFile, tls.VersionTLS11, []string{CertExpiring, CertWeakProtocol}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(handler)
+			if tt.cert != nil {
+				ts.TLS = &tls.Config{Certificates: []tls.Certificate{*tt.cert}, MinVersion: tls.VersionTLS10, MaxVersion: tt.maxVersion}
+			}
+			ts.StartTLS()
+			defer ts.Close()
+
+			s := runScan(t, &conf.Config{HTTP: conf.HTTP{CAFile: tt.caFile}}, nil, conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: 2, IgnoreRobots: true})
+
+			got := make([]string, 0)
+			for _, c := range s.Certificates {
+				if c.Host != strings.TrimPrefix(ts.URL, "https://") {
+					t.Errorf("Host: %s", c.Host)
+				}
+				got = append(got, c.Category)
+			}
+			sort.Strings(got)
+			sort.Strings(tt.want)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Certificates:\r\nполучено: %v\r\nожидается: %v\r\n%+v", got, tt.want, s.Certificates)
+			}
+			if len(s.Errors) != 0 {
+				t.Errorf("Errors: %v", s.Errors)
+			}
+		})
+	}
+}
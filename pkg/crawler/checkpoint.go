@@ -0,0 +1,355 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+// Параметры сохранения состояния по умолчанию
+const (
+	// Каталог для файлов состояния
+	defaultStateDir = "./state"
+	// Интервал сохранения состояния
+	defaultCheckpointInterval = 30 * time.Second
+	// Максимальная длина имени в ключе файла состояния
+	maxCheckpointName = 64
+)
+
+// Файлы состояния называются scan-<ключ>.json
+const (
+	checkpointPrefix = "scan-"
+	checkpointExt    = ".json"
+)
+
+// checkpointTask это ссылка из очереди в файле состояния
+type checkpointTask struct {
+	Link     string
+	BaseLink string
+	Depth    int
+	Tag      string `json:",omitempty"`
+	Attr     string `json:",omitempty"`
+	Text     string `json:",omitempty"`
+	Line     int    `json:",omitempty"`
+	Column   int    `json:",omitempty"`
+	Page     int    `json:",omitempty"`
+	Nofollow bool   `json:",omitempty"`
+	Key      string `json:",omitempty"`
+}
+
+// newCheckpointTask возвращает ссылку очереди для файла состояния
+func newCheckpointTask(t task) checkpointTask {
+	return checkpointTask{Link: t.link, BaseLink: t.baseLink, Depth: t.depth, Tag: t.tag, Attr: t.attr, Text: t.text,
+		Line: t.line, Column: t.column, Page: t.page, Nofollow: t.nofollow, Key: t.key}
+}
+
+// task возвращает ссылку очереди из файла состояния
+func (t checkpointTask) task() task {
+	return task{link: t.Link, baseLink: t.BaseLink, depth: t.Depth, tag: t.Tag, attr: t.Attr, text: t.Text,
+		line: t.Line, column: t.Column, page: t.Page, nofollow: t.Nofollow, key: t.Key}
+}
+
+// checkpoint это состояние сканирования, достаточное, чтобы продолжить его после перезапуска
+type checkpoint struct {
+	ID int
+	// Имя расписания, по которому запущено сканирование
+	Name     string `json:",omitempty"`
+	Schedule conf.ScheduleData
+	Workers  int
+	// Время сканирования до сохранения и время, проведенное на паузе
+	Elapsed time.Duration
+	Paused  time.Duration
+	// Очередь, включая ссылки, которые обрабатывались в момент сохранения
+	Frontier  []checkpointTask
+	Seen      []string
+	Processed []string
+	Visited   []string
+	Errors    map[string]ErrorResult
+	Skipped   map[string]SkipResult
+	Findings  []Finding
+	// Хранилище cookie
+	Jar       []cookieEntry
+	Sitemap   map[string]string
+	Linked    map[string]bool
+	Anchors   map[string]map[string]bool
+	Fragments map[string]map[string]*fragmentRef
+	Refs      map[string][]LinkRef
+	// Обнаруженные ловушки
+	Traps []string
+	// Проблемы сертификатов и проверенные хосты
+	Certificates []CertificateIssue
+	CertHosts    []string
+	// Расход бюджетов
+	Pages     int
+	HostPages map[string]int
+	Bytes     int64
+}
+
+// checkpointKey возвращает ключ файла состояния сканирования. Ключ не зависит от идентификатора процесса,
+// который после перезапуска может достаться другому сканированию: он составлен из имени расписания
+// (или первого стартового URL) и времени начала сканирования
+func checkpointKey(name string, urls []string, started time.Time) string {
+	if name == "" && len(urls) > 0 {
+		name = urls[0]
+		if u, err := url.Parse(name); err == nil && u.Host != "" {
+			name = u.Host + u.Path
+		}
+	}
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(name) > maxCheckpointName {
+		name = name[:maxCheckpointName]
+	}
+	return strings.Trim(name, "_") + "-" + started.UTC().Format("20060102-150405.000000000")
+}
+
+// checkpointPath возвращает путь к файлу состояния сканирования с ключом key
+func checkpointPath(dir string, key string) string {
+	return filepath.Join(dir, checkpointPrefix+key+checkpointExt)
+}
+
+// Checkpoints возвращает ключи прерванных сканирований, состояние которых сохранено на диске
+func Checkpoints(cfg *conf.Config) ([]string, error) {
+	dir := cfg.Crawler.StateDir
+	if dir == "" {
+		dir = defaultStateDir
+	}
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(files))
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, checkpointPrefix) || !strings.HasSuffix(name, checkpointExt) {
+			continue
+		}
+		keys = append(keys, strings.TrimSuffix(strings.TrimPrefix(name, checkpointPrefix), checkpointExt))
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// checkpoint сохраняет состояние сканирования на диск. inFlight - ссылки, переданные обработчикам:
+// они возвращаются в очередь, т.к. после перезапуска их нужно просканировать заново.
+// Вызывается только из горутины диспетчера, которой принадлежит очередь
+func (s *Service) checkpoint(inFlight map[string]task) {
+	if s.checkpointInterval < 0 {
+		return
+	}
+	cp := checkpoint{
+		ID:       s.ID,
+		Name:     s.Schedule,
+		Schedule: s.sched,
+		Workers:  s.Workers,
+		Elapsed:  time.Since(s.started),
+		Frontier: make([]checkpointTask, 0, len(inFlight)+s.frontier.len()),
+		Seen:     make([]string, 0, len(s.frontier.seen)),
+	}
+	for _, t := range inFlight {
+		cp.Frontier = append(cp.Frontier, newCheckpointTask(t))
+	}
+	for i := 0; i < s.frontier.len(); i++ {
+		cp.Frontier = append(cp.Frontier, newCheckpointTask(s.frontier.at(i)))
+	}
+	for link := range s.frontier.seen {
+		cp.Seen = append(cp.Seen, link)
+	}
+
+	s.mux.RLock()
+	inFlightLinks := make(map[string]bool, len(inFlight))
+	for _, t := range inFlight {
+		inFlightLinks[t.link] = true
+	}
+	cp.Processed = make([]string, 0, len(s.Processed))
+	for link := range s.Processed {
+		if !inFlightLinks[link] {
+			cp.Processed = append(cp.Processed, link)
+		}
+	}
+	cp.Visited = make([]string, 0, len(s.visited))
+	for key := range s.visited {
+		if _, ok := inFlight[key]; !ok {
+			cp.Visited = append(cp.Visited, key)
+		}
+	}
+	cp.Errors = s.Errors
+	cp.Skipped = s.Skipped
+	cp.Findings = s.Findings
+	cp.Jar = s.cookies.list()
+	cp.Sitemap = s.sitemap
+	cp.Linked = s.linked
+	cp.Anchors = s.anchors
+	cp.Certificates = s.Certificates
+	// Ссылки, которые обработчики уже начали запрашивать, после продолжения запрашиваются заново
+	// и снова расходуют бюджет страниц
+	cp.Pages = s.budget.pages
+	cp.HostPages = make(map[string]int, len(s.budget.hostPages))
+	for host, n := range s.budget.hostPages {
+		cp.HostPages[host] = n
+	}
+	for key, t := range inFlight {
+		if !s.visited[key] {
+			continue
+		}
+		cp.Pages--
+		if u, err := url.Parse(t.link); err == nil {
+			cp.HostPages[u.Hostname()]--
+		}
+	}
+	cp.Bytes = atomic.LoadInt64(&s.budget.bytes)
+	cp.Paused = s.pausedTime()
+	cp.Fragments = s.fragments
+	cp.Refs = s.refs
+	s.traps.mux.Lock()
+	for trap := range s.traps.found {
+		cp.Traps = append(cp.Traps, trap)
+	}
+	s.traps.mux.Unlock()
+	s.certs.mux.Lock()
+	for host := range s.certs.checked {
+		cp.CertHosts = append(cp.CertHosts, host)
+	}
+	s.certs.mux.Unlock()
+	data, err := json.Marshal(cp)
+	s.mux.RUnlock()
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Checkpoint, ID: %d: %v", s.ID, err))
+		return
+	}
+
+	if err := writeFileAtomic(checkpointPath(s.stateDir, s.checkpointKey), data); err != nil {
+		s.logger.Error(fmt.Sprintf("Checkpoint, ID: %d: %v", s.ID, err))
+	}
+}
+
+// writeFileAtomic записывает файл через временный файл, чтобы при сбое не оставить его недописанным
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// removeCheckpoint удаляет состояние завершенного сканирования. Удаляется только файл этого сканирования:
+// состояния других прерванных сканирований остаются, пока их не продолжат
+func (s *Service) removeCheckpoint() {
+	if err := os.Remove(checkpointPath(s.stateDir, s.checkpointKey)); err != nil && !os.IsNotExist(err) {
+		s.logger.Error(fmt.Sprintf("Checkpoint, ID: %d: %v", s.ID, err))
+	}
+}
+
+// Resume продолжает прерванное сканирование с ключом key (см. Checkpoints) с момента последнего сохранения
+// состояния. Состояние и дальше сохраняется в тот же файл. Если состояние не найдено, возвращает ошибку,
+// не начиная сканирования
+func (s *Service) Resume(key string) error {
+	if key == "" || strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("invalid checkpoint %q", key)
+	}
+	data, err := ioutil.ReadFile(checkpointPath(s.stateDir, key))
+	if err != nil {
+		return err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("checkpoint %s: %v", key, err)
+	}
+
+	s.checkpointKey = key
+	s.resumed = true
+	s.Schedule = cp.Name
+	s.started = time.Now().Add(-cp.Elapsed)
+	s.budget.paused = cp.Paused
+	if cp.Workers > 0 {
+		s.Workers = cp.Workers
+	}
+	s.logger.Info(fmt.Sprintf("Resumed, ID: %d, checkpoint: %s, workers: %d, %d URLs in queue...", s.ID, key, s.Workers, len(cp.Frontier)))
+	s.restore(cp)
+	if err := s.setup(cp.Schedule); err != nil {
+		// Состояние остается на диске, чтобы продолжить сканирование, когда причина будет устранена
+		s.stop(err.Error())
+		s.publish(ScanResult{})
+		return err
+	}
+	// Ссылки очереди уже отмечены в восстановленном списке поставленных в очередь
+	for _, t := range cp.Frontier {
+		s.frontier.requeue(t.task())
+	}
+	s.run()
+	s.finish()
+	return nil
+}
+
+// restore восстанавливает состояние сканирования из файла состояния
+func (s *Service) restore(cp checkpoint) {
+	for _, link := range cp.Seen {
+		s.frontier.seen[link] = true
+	}
+	for _, trap := range cp.Traps {
+		s.traps.found[trap] = true
+	}
+	for _, host := range cp.CertHosts {
+		s.certs.checked[host] = true
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, link := range cp.Processed {
+		s.Processed[link] = true
+	}
+	for _, key := range cp.Visited {
+		s.visited[key] = true
+	}
+	if cp.Errors != nil {
+		s.Errors = cp.Errors
+	}
+	if cp.Skipped != nil {
+		s.Skipped = cp.Skipped
+	}
+	if cp.Findings != nil {
+		s.Findings = cp.Findings
+	}
+	s.cookies.add(cp.Jar)
+	if cp.Sitemap != nil {
+		s.sitemap = cp.Sitemap
+	}
+	if cp.Linked != nil {
+		s.linked = cp.Linked
+	}
+	if cp.Anchors != nil {
+		s.anchors = cp.Anchors
+	}
+	if cp.Certificates != nil {
+		s.Certificates = cp.Certificates
+	}
+	s.budget.pages = cp.Pages
+	if cp.HostPages != nil {
+		s.budget.hostPages = cp.HostPages
+	}
+	atomic.StoreInt64(&s.budget.bytes, cp.Bytes)
+	if cp.Fragments != nil {
+		s.fragments = cp.Fragments
+	}
+	if cp.Refs != nil {
+		s.refs = cp.Refs
+	}
+}
@@ -0,0 +1,236 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+	"blc/pkg/logger"
+)
+
+func TestService_resume(t *testing.T) {
+	var requests sync.Map
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := requests.LoadOrStore(r.URL.Path, new(int32))
+		atomic.AddInt32(n.(*int32), 1)
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/missing">missing</a><a href="/a.html">a</a>`)
+		case "/a.html":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/b.html">b</a>`)
+		case "/b.html":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `b`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "blc-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &conf.Config{Crawler: conf.Crawler{StateDir: dir}}
+	// Состояние другого прерванного сканирования не должно быть изменено или удалено
+	other := checkpointPath(dir, "other-20200101-000000.000000000")
+	if err := ioutil.WriteFile(other, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	chReport := make(chan *Service)
+	go func() {
+		for {
+			<-chReport
+		}
+	}()
+
+	// Первый процесс ставим на паузу после сканирования стартовой страницы и прерываем
+	s := New(1, cfg, chReport, logger.New(ioutil.Discard, ioutil.Discard))
+	s.Schedule = "nightly"
+	go func(s *Service) {
+		for r := range s.ChResults {
+			if r.URL == ts.URL+"/" && r.State == 1 {
+				go s.Command("PAUSE")
+			}
+		}
+	}(s)
+	done := make(chan struct{})
+	go func() {
+		s.Scan(conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: -1})
+		close(done)
+	}()
+	var key string
+	var saved []byte
+	for i := 0; i < 50 && saved == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+		keys, err := Checkpoints(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			if strings.HasPrefix(k, "nightly-") {
+				key = k
+				saved, _ = ioutil.ReadFile(checkpointPath(dir, key))
+			}
+		}
+	}
+	if saved == nil {
+		t.Fatal("Состояние не сохранено при паузе")
+	}
+	path := checkpointPath(dir, key)
+	s.Command("CANCEL")
+	<-done
+	close(s.ChResults)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Состояние не удалено после завершения: %v", err)
+	}
+	if data, err := ioutil.ReadFile(other); err != nil || string(data) != "{}" {
+		t.Errorf("Состояние другого сканирования изменено: %q, %v", data, err)
+	}
+
+	// Имитируем перезапуск: возвращаем сохраненное состояние и продолжаем сканирование
+	if err := ioutil.WriteFile(path, saved, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Продолженное сканирование получает другой идентификатор процесса
+	s = New(2, cfg, chReport, logger.New(ioutil.Discard, ioutil.Discard))
+	go func() {
+		for range s.ChResults {
+		}
+	}()
+	if err := s.Resume("../" + key); err == nil {
+		t.Error("Resume принимает путь вместо ключа")
+	}
+	if err := s.Resume(key); err != nil {
+		t.Fatal(err)
+	}
+	close(s.ChResults)
+
+	got := make([]string, 0)
+	for u := range s.Processed {
+		got = append(got, u)
+	}
+	sort.Strings(got)
+	want := []string{ts.URL + "/", ts.URL + "/a.html", ts.URL + "/b.html", ts.URL + "/missing"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Processed:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+	if _, ok := s.Errors[ts.URL+"/missing"]; !ok || len(s.Errors) != 1 {
+		t.Errorf("Errors: получено %v, ожидается %s", s.Errors, ts.URL+"/missing")
+	}
+	if n, _ := requests.Load("/"); atomic.LoadInt32(n.(*int32)) != 1 {
+		t.Errorf("Стартовая страница загружена %d раз, ожидается 1", atomic.LoadInt32(n.(*int32)))
+	}
+	if s.URLs[0] != ts.URL+"/" || len(s.URLs) != 1 {
+		t.Errorf("URLs: получено %v", s.URLs)
+	}
+	if s.Schedule != "nightly" {
+		t.Errorf("Schedule: получено %q, ожидается nightly", s.Schedule)
+	}
+	if keys, err := Checkpoints(cfg); err != nil || !reflect.DeepEqual(keys, []string{"other-20200101-000000.000000000"}) {
+		t.Errorf("Checkpoints: получено %v, %v", keys, err)
+	}
+}
+
+func TestService_resumeSession(t *testing.T) {
+	var logins int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "new"})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("sid"); err != nil || c.Value != "restored" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	dir := t.TempDir()
+	os.Setenv("BLC_TEST_PASSWORD", "secret")
+	defer os.Unsetenv("BLC_TEST_PASSWORD")
+	cfg := &conf.Config{
+		Crawler: conf.Crawler{StateDir: dir},
+		Credentials: map[string]*conf.Credentials{"form": {
+			Type: AuthForm, LoginURL: ts.URL + "/login", Username: "checker", Password: "${env:BLC_TEST_PASSWORD}",
+		}},
+	}
+	if err := CheckCredentials(cfg); err != nil {
+		t.Fatal(err)
+	}
+	page := task{link: ts.URL + "/page", baseLink: ts.URL + "/", depth: 1, key: ts.URL + "/page"}
+	cp := checkpoint{
+		Schedule: conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: 2, IgnoreRobots: true, Credentials: []string{"form"}},
+		Frontier: []checkpointTask{newCheckpointTask(page)},
+		Jar:      []cookieEntry{{Domain: u.Hostname(), HostOnly: true, Path: "/", Name: "sid", Value: "restored"}},
+		Pages:    1,
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "session-20200101-000000.000000000"
+	if err := ioutil.WriteFile(checkpointPath(dir, key), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	chReport := make(chan *Service, 1)
+	s := New(1, cfg, chReport, logger.New(ioutil.Discard, ioutil.Discard))
+	go func() {
+		for range s.ChResults {
+		}
+	}()
+	if err := s.Resume(key); err != nil {
+		t.Fatal(err)
+	}
+	<-chReport
+	close(s.ChResults)
+
+	// Сессия из файла состояния действует, входить заново не нужно
+	if n := atomic.LoadInt32(&logins); n != 0 {
+		t.Errorf("Вход выполнен %d раз, ожидается 0", n)
+	}
+	if len(s.Errors) != 0 || !s.Processed[page.link] {
+		t.Errorf("Errors: %v, Processed: %v", s.Errors, s.Processed)
+	}
+
+	// Ссылки, переданные обработчикам, не учитываются в сохраненном бюджете страниц: после продолжения
+	// они запрашиваются заново
+	s.checkpointKey = "pages-20200101-000000.000000000"
+	s.budget.pages = 2
+	s.budget.hostPages = map[string]int{u.Hostname(): 2}
+	started := task{link: ts.URL + "/started", key: ts.URL + "/started", depth: 1}
+	waiting := task{link: ts.URL + "/waiting", key: ts.URL + "/waiting", depth: 1}
+	s.visited[started.id()] = true
+	s.checkpoint(map[string]task{started.id(): started, waiting.id(): waiting})
+	data, err = ioutil.ReadFile(checkpointPath(dir, s.checkpointKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp = checkpoint{}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		t.Fatal(err)
+	}
+	if cp.Pages != 1 || cp.HostPages[u.Hostname()] != 1 || s.budget.hostPages[u.Hostname()] != 2 {
+		t.Errorf("Pages: %d, HostPages: %v, ожидается 1", cp.Pages, cp.HostPages)
+	}
+}
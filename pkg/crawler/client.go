@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+// Параметры HTTP-клиента по умолчанию
+const (
+	// Время ожидания ответа, включая чтение тела
+	defaultTimeout = 15 * time.Second
+	// Время установки соединения
+	defaultConnectTimeout = 10 * time.Second
+	// Время TLS-рукопожатия
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	// Количество неактивных соединений с одним хостом, которые держатся открытыми для повторного использования
+	defaultMaxIdleConnsPerHost = 8
+	// Время, через которое закрывается неактивное соединение
+	idleConnTimeout = 90 * time.Second
+)
+
+// CheckHTTP проверяет настройки HTTP-клиента из конфигурации
+func CheckHTTP(cfg *conf.Config) error {
+	if _, err := newTransport(cfg.HTTP); err != nil {
+		return err
+	}
+	if err := newHostOverrides().add(cfg.HTTP.Resolve); err != nil {
+		return err
+	}
+	_, err := parseRewrites(cfg.HTTP.Rewrite)
+	return err
+}
+
+// newTransport возвращает транспорт, общий для всех запросов сканирования
+func newTransport(cfg conf.HTTP) (*http.Transport, error) {
+	connectTimeout := seconds(cfg.ConnectTimeout, defaultConnectTimeout)
+	// Устаревшие версии TLS разрешены, чтобы проверить такие сайты и сообщить о версии в отчете
+	tlsConfig := &tls.Config{InsecureSkipVerify: !cfg.VerifyTLS, MinVersion: tls.VersionTLS10}
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s: no certificates found", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	// Без явно заданного прокси используются переменные окружения HTTP_PROXY, HTTPS_PROXY и NO_PROXY
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %v", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy %s: unsupported scheme %q", cfg.Proxy, u.Scheme)
+		}
+		proxy = http.ProxyURL(u)
+	}
+	maxIdle := cfg.MaxIdleConnsPerHost
+	if maxIdle <= 0 {
+		maxIdle = defaultMaxIdleConnsPerHost
+	}
+	tr := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   seconds(cfg.TLSHandshakeTimeout, defaultTLSHandshakeTimeout),
+		ResponseHeaderTimeout: seconds(cfg.ResponseHeaderTimeout, 0),
+		MaxIdleConnsPerHost:   maxIdle,
+		IdleConnTimeout:       idleConnTimeout,
+		ForceAttemptHTTP2:     !cfg.DisableHTTP2,
+	}
+	if cfg.DisableHTTP2 {
+		// Непустой TLSNextProto отключает HTTP/2
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return tr, nil
+}
+
+// newHTTPClient возвращает HTTP-клиент сканирования и устанавливает исполнитель запросов по сети. Если настройки
+// из конфигурации неверны, клиент создается с настройками по умолчанию. Соединения устанавливаются с учетом подмен
+// адресов хостов, запросы отправляются с учетом правил замены URL
+func (s *Service) newHTTPClient(cfg conf.HTTP) *http.Client {
+	tr, err := newTransport(cfg)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("HTTP settings are ignored: %v", err))
+		tr, _ = newTransport(conf.HTTP{})
+	}
+	tr.DialContext = s.overrides.dial(tr.DialContext)
+	s.fetcher = liveFetcher{tr}
+	return &http.Client{
+		Timeout:       seconds(cfg.Timeout, defaultTimeout),
+		Transport:     rewriteTransport{s},
+		CheckRedirect: s.checkRedirect,
+	}
+}
+
+// seconds переводит значение из конфигурации в секундах в длительность.
+// 0 означает значение по умолчанию, отрицательное значение - отсутствие ограничения
+func seconds(value int, def time.Duration) time.Duration {
+	switch {
+	case value == 0:
+		return def
+	case value < 0:
+		return 0
+	}
+	return time.Duration(value) * time.Second
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_httpClient(t *testing.T) {
+	var conns int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			for i := 0; i < 10; i++ {
+				fmt.Fprintf(w, `<a href="/page-%d">%d</a>`, i, i)
+			}
+		}
+	})
+	ts := httptest.NewUnstartedServer(handler)
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	// Прокси отвечает на запросы к любым хостам
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.IsAbs() {
+			atomic.AddInt32(&proxied, 1)
+		}
+		w.Header().Set("Content-Type", "text/html")
+	}))
+	defer proxy.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(cfg conf.HTTP, link string) *testScan {
+		return runScan(t, &conf.Config{Crawler: conf.Crawler{Workers: 1}, HTTP: cfg}, nil, conf.ScheduleData{URL: []string{link}, Depth: 2, IgnoreRobots: true})
+	}
+
+	if s := scan(conf.HTTP{}, ts.URL+"/"); len(s.Errors) != 0 {
+		t.Errorf("Без проверки сертификата: %v", s.Errors)
+	}
+	// Соединения используются повторно
+	if n := atomic.LoadInt32(&conns); n > 2 {
+		t.Errorf("Соединений: %d, ожидается не больше 2", n)
+	}
+	if s := scan(conf.HTTP{VerifyTLS: true}, ts.URL+"/"); len(s.Errors) != 1 {
+		t.Errorf("Ожидается ошибка проверки сертификата: %v", s.Errors)
+	}
+	if s := scan(conf.HTTP{VerifyTLS: true, CAFile: caFile}, ts.URL+"/"); len(s.Errors) != 0 {
+		t.Errorf("С сертификатом CA: %v", s.Errors)
+	}
+	if s := scan(conf.HTTP{Proxy: proxy.URL}, "http://blc.invalid/"); len(s.Errors) != 0 || atomic.LoadInt32(&proxied) != 1 {
+		t.Errorf("Прокси: запросов %d, ошибки %v", atomic.LoadInt32(&proxied), s.Errors)
+	}
+
+	for _, cfg := range []conf.HTTP{{CAFile: filepath.Join(t.TempDir(), "missing.pem")}, {CAFile: "crawler_test.go"}, {Proxy: "ftp://127.0.0.1"}} {
+		if err := CheckHTTP(&conf.Config{HTTP: cfg}); err == nil {
+			t.Errorf("Ожидается ошибка для %+v", cfg)
+		}
+	}
+}
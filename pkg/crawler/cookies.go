@@ -0,0 +1,307 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"blc/pkg/conf"
+)
+
+// Режимы работы с cookie
+const (
+	// CookiesSession - хранится только cookie сессии с именем SessionName
+	CookiesSession = "session"
+	// CookiesJar - хранятся все cookie
+	CookiesJar = "jar"
+	// CookiesNone - cookie не отправляются
+	CookiesNone = "none"
+)
+
+// Префикс домена cookie с атрибутом HttpOnly в файле cookies.txt
+const httpOnlyPrefix = "#HttpOnly_"
+
+// cookieEntry это cookie, сохраняемая между запусками сканирования
+type cookieEntry struct {
+	Domain string
+	// Cookie отправляется только хосту Domain, без поддоменов
+	HostOnly bool
+	Path     string
+	Secure   bool
+	HTTPOnly bool
+	// Нулевое время - cookie сессии
+	Expires time.Time
+	Name    string
+	Value   string
+}
+
+// key возвращает ключ cookie: cookie с тем же доменом, путем и именем заменяет прежнюю
+func (e cookieEntry) key() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+// cookie возвращает cookie для добавления в хранилище по URL u
+func (e cookieEntry) cookie() (*url.URL, *http.Cookie) {
+	u := url.URL{Scheme: "http", Host: e.Domain, Path: e.Path}
+	if e.Secure {
+		u.Scheme = "https"
+	}
+	c := http.Cookie{Name: e.Name, Value: e.Value, Path: e.Path, Secure: e.Secure, HttpOnly: e.HTTPOnly, Expires: e.Expires}
+	if !e.HostOnly {
+		c.Domain = e.Domain
+	}
+	return &u, &c
+}
+
+// cookieJar это хранилище cookie по RFC 6265, которое запоминает полученные cookie,
+// чтобы их можно было сохранить в файл cookies.txt и в состояние сканирования
+type cookieJar struct {
+	jar *cookiejar.Jar
+	mux sync.Mutex
+	// Имя единственной принимаемой cookie (пустое - принимаются все)
+	only    string
+	entries map[string]cookieEntry
+}
+
+// newCookieJar возвращает пустое хранилище cookie
+func newCookieJar() *cookieJar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &cookieJar{jar: jar, entries: make(map[string]cookieEntry)}
+}
+
+// SetCookies сохраняет cookie, полученные в ответе на запрос u
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	accepted := make([]*http.Cookie, 0, len(cookies))
+	now := time.Now()
+	for _, c := range cookies {
+		if j.only != "" && c.Name != j.only {
+			continue
+		}
+		accepted = append(accepted, c)
+		e := cookieEntry{
+			Domain:   strings.ToLower(u.Hostname()),
+			HostOnly: true,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+			Name:     c.Name,
+			Value:    c.Value,
+		}
+		if c.Domain != "" {
+			e.Domain, e.HostOnly = strings.ToLower(strings.TrimPrefix(c.Domain, ".")), false
+		}
+		if e.Path == "" || e.Path[0] != '/' {
+			// Путь по умолчанию - каталог запрошенного документа (RFC 6265, 5.1.4)
+			e.Path = "/"
+			if i := strings.LastIndex(u.Path, "/"); i > 0 {
+				e.Path = u.Path[:i]
+			}
+		}
+		switch {
+		case c.MaxAge < 0:
+			e.Expires = now
+		case c.MaxAge > 0:
+			e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			e.Expires = c.Expires
+		}
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			delete(j.entries, e.key())
+			continue
+		}
+		j.entries[e.key()] = e
+	}
+	j.jar.SetCookies(u, accepted)
+}
+
+// Cookies возвращает cookie для запроса u
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// acceptOnly ограничивает принимаемые cookie одной cookie с именем name (пустое имя снимает ограничение)
+func (j *cookieJar) acceptOnly(name string) {
+	j.mux.Lock()
+	j.only = name
+	j.mux.Unlock()
+}
+
+// empty проверяет, что в хранилище нет cookie
+func (j *cookieJar) empty() bool {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return len(j.entries) == 0
+}
+
+// add добавляет cookie в хранилище, пропуская истекшие
+func (j *cookieJar) add(entries []cookieEntry) {
+	now := time.Now()
+	for _, e := range entries {
+		if !e.Expires.IsZero() && !e.Expires.After(now) {
+			continue
+		}
+		u, c := e.cookie()
+		j.SetCookies(u, []*http.Cookie{c})
+	}
+}
+
+// list возвращает действующие cookie хранилища
+func (j *cookieJar) list() []cookieEntry {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	now := time.Now()
+	entries := make([]cookieEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		if e.Expires.IsZero() || e.Expires.After(now) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, k int) bool { return entries[i].key() < entries[k].key() })
+	return entries
+}
+
+// CheckCookies проверяет настройки cookie сканирования
+func CheckCookies(sched conf.ScheduleData) error {
+	if _, err := cookiesMode(sched); err != nil {
+		return err
+	}
+	if sched.CookieFile == "" {
+		if sched.SaveCookies {
+			return fmt.Errorf("cookie file is required to save cookies")
+		}
+		return nil
+	}
+	if _, err := readCookieFile(sched.CookieFile); err != nil && !(os.IsNotExist(err) && sched.SaveCookies) {
+		return err
+	}
+	return nil
+}
+
+// cookiesMode возвращает режим работы с cookie сканирования
+func cookiesMode(sched conf.ScheduleData) (string, error) {
+	switch m := strings.ToLower(sched.Cookies); m {
+	case "":
+		return CookiesSession, nil
+	case CookiesSession, CookiesJar, CookiesNone:
+		return m, nil
+	}
+	return CookiesSession, fmt.Errorf("unknown cookies mode %q", sched.Cookies)
+}
+
+// readCookieFile читает cookie из файла в формате Netscape cookies.txt
+func readCookieFile(name string) ([]cookieEntry, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var entries []cookieEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		// Пробелы не обрезаются: значение cookie в последнем поле может быть пустым
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab-separated fields", name, n)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid expiration time %q", name, n, fields[4])
+		}
+		e := cookieEntry{
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HTTPOnly: httpOnly,
+			Name:     fields[5],
+			Value:    fields[6],
+		}
+		if expires > 0 {
+			e.Expires = time.Unix(expires, 0)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// writeCookieFile записывает cookie в файл в формате Netscape cookies.txt
+func writeCookieFile(name string, entries []cookieEntry) error {
+	var b bytes.Buffer
+	b.WriteString("# Netscape HTTP Cookie File\n")
+	flag := func(v bool) string {
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	for _, e := range entries {
+		domain := e.Domain
+		if !e.HostOnly {
+			domain = "." + domain
+		}
+		if e.HTTPOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !e.Expires.IsZero() {
+			expires = e.Expires.Unix()
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, flag(!e.HostOnly), e.Path, flag(e.Secure), expires, e.Name, e.Value)
+	}
+	return writeFileAtomic(name, b.Bytes())
+}
+
+// setupCookies подключает хранилище cookie к клиенту в зависимости от режима сканирования и
+// заполняет его из файла CookieFile. Продолженное сканирование использует cookie из сохраненного состояния
+func (s *Service) setupCookies(sched conf.ScheduleData) {
+	mode, err := cookiesMode(sched)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Cookies, ID: %d: %v", s.ID, err))
+	}
+	switch {
+	case mode == CookiesNone, mode == CookiesSession && sched.SessionName == "":
+		return
+	case mode == CookiesSession:
+		s.cookies.acceptOnly(sched.SessionName)
+	}
+	// Продолженное сканирование использует cookie из файла состояния
+	if sched.CookieFile != "" && !s.resumed && s.cookies.empty() {
+		entries, err := readCookieFile(sched.CookieFile)
+		switch {
+		case err == nil:
+			s.cookies.add(entries)
+		case !os.IsNotExist(err):
+			s.logger.Error(fmt.Sprintf("Cookies, ID: %d: %v", s.ID, err))
+		}
+	}
+	s.client.Jar = s.cookies
+}
+
+// saveCookies сохраняет cookie в файл CookieFile для следующего запуска сканирования
+func (s *Service) saveCookies() {
+	if !s.sched.SaveCookies || s.sched.CookieFile == "" || s.client.Jar == nil {
+		return
+	}
+	if err := writeCookieFile(s.sched.CookieFile, s.cookies.list()); err != nil {
+		s.logger.Error(fmt.Sprintf("Cookies, ID: %d: %v", s.ID, err))
+	}
+}
@@ -0,0 +1,115 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_cookies(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, c := range r.Cookies() {
+			names = append(names, c.Name)
+		}
+		sort.Strings(names)
+		mu.Lock()
+		received[r.URL.Path] = names
+		mu.Unlock()
+		if r.URL.Path == "/" {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+			http.SetCookie(w, &http.Cookie{Name: "pref", Value: "dark", Path: "/app", MaxAge: 3600})
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/app/page">app</a> <a href="/other">other</a>`)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	dir := t.TempDir()
+	seed := filepath.Join(dir, "cookies.txt")
+	tests := []struct {
+		name  string
+		sched conf.ScheduleData
+		// Cookie, полученные сервером по путям
+		received map[string][]string
+		// Cookie в сохраненном файле
+		saved []string
+	}{
+		{
+			name:     "none",
+			sched:    conf.ScheduleData{Cookies: CookiesNone, SessionName: "sid"},
+			received: map[string][]string{"/": nil, "/app/page": nil, "/other": nil},
+		},
+		{
+			name:     "session",
+			sched:    conf.ScheduleData{SessionName: "sid"},
+			received: map[string][]string{"/": nil, "/app/page": {"sid"}, "/other": {"sid"}},
+		},
+		{
+			name:     "jar",
+			sched:    conf.ScheduleData{Cookies: CookiesJar},
+			received: map[string][]string{"/": nil, "/app/page": {"pref", "sid"}, "/other": {"sid"}},
+		},
+		{
+			name:     "seed and save",
+			sched:    conf.ScheduleData{Cookies: CookiesJar, CookieFile: seed, SaveCookies: true},
+			received: map[string][]string{"/": {"seeded"}, "/app/page": {"pref", "seeded", "sid"}, "/other": {"seeded", "sid"}},
+			saved:    []string{"pref", "seeded", "sid"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies := "# Netscape HTTP Cookie File\n" + u.Hostname() + "\tFALSE\t/\tFALSE\t0\tseeded\tyes\n" +
+				".example.com\tTRUE\t/\tFALSE\t1\texpired\tno\n"
+			if err := ioutil.WriteFile(seed, []byte(cookies), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := CheckCookies(tt.sched); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			received = make(map[string][]string)
+			mu.Unlock()
+			sched := tt.sched
+			sched.URL, sched.Depth, sched.IgnoreRobots = []string{ts.URL + "/"}, 2, true
+			runScan(t, nil, nil, sched)
+
+			mu.Lock()
+			if !reflect.DeepEqual(received, tt.received) {
+				t.Errorf("Cookies:\r\nполучено: %v\r\nожидается: %v", received, tt.received)
+			}
+			mu.Unlock()
+			if tt.saved == nil {
+				return
+			}
+			entries, err := readCookieFile(seed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var saved []string
+			for _, e := range entries {
+				saved = append(saved, e.Name)
+			}
+			sort.Strings(saved)
+			if !reflect.DeepEqual(saved, tt.saved) {
+				t.Errorf("Saved cookies: получено %v, ожидается %v", saved, tt.saved)
+			}
+		})
+	}
+
+	if err := CheckCookies(conf.ScheduleData{Cookies: "all"}); err == nil {
+		t.Error("Unknown cookies mode is accepted")
+	}
+}
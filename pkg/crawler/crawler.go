@@ -1,20 +1,83 @@
 package crawler
 
 import (
-	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/html"
 
+	"blc/pkg/conf"
 	"blc/pkg/logger"
 )
 
+// Параметры по умолчанию
+const (
+	// Количество параллельных обработчиков
+	defaultWorkers = 1
+	// Максимальная длина очереди ссылок
+	defaultMaxQueue = 100000
+	// Максимальный размер CSS-файла, в котором ищутся ссылки
+	maxCSSSize = 5 * 1024 * 1024
+	// Сколько мест, где найдена ссылка, запоминается для отчета
+	maxLinkRefs = 1000
+)
+
+// Заголовок User-Agent для запросов
+const userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.104 Safari/537.36"
+
+// Причины пропуска ссылок
+const (
+	// SkippedByRobots - ссылка запрещена в robots.txt
+	SkippedByRobots = "skipped by robots"
+	// SkippedOutOfScope - ссылка вне области сканирования
+	SkippedOutOfScope = "out of scope"
+	// SkippedByRule - ссылка игнорируется правилом классификации
+	SkippedByRule = "ignored by rule"
+	// SkippedByHostBudget - исчерпан бюджет ссылок для хоста
+	SkippedByHostBudget = "host budget exhausted"
+	// SkippedQueueFull - очередь ссылок заполнена (Crawler.MaxQueue)
+	SkippedQueueFull = "queue full"
+)
+
+// Типы ошибок
+const (
+	// ErrorTypeFragment - на странице нет якоря, на который ведет ссылка
+	ErrorTypeFragment = "fragment"
+	// ErrorTypeRedirectLoop - перенаправления зациклились
+	ErrorTypeRedirectLoop = "redirect loop"
+)
+
+// Категории замечаний
+const (
+	// FindingSitemap - ссылка из sitemap недоступна, перенаправляет на другой адрес или sitemap не удалось загрузить
+	FindingSitemap = "sitemap"
+	// FindingOrphan - страница есть в sitemap, но на нее нет ссылок с других страниц
+	FindingOrphan = "orphan page"
+	// FindingRedirectChain - слишком длинная цепочка перенаправлений
+	FindingRedirectChain = "long redirect chain"
+	// FindingPermanentRedirect - ссылка постоянно перенаправляет на другой адрес, ее нужно обновить на странице
+	FindingPermanentRedirect = "permanent redirect"
+	// FindingRedirectDowngrade - перенаправление с HTTPS на HTTP
+	FindingRedirectDowngrade = "https to http redirect"
+	// FindingCrossDomainRedirect - перенаправление на другой домен
+	FindingCrossDomainRedirect = "cross-domain redirect"
+	// FindingWarning - ссылка рабочая, но правило классификации требует обратить на нее внимание
+	FindingWarning = "warning"
+	// FindingFlaky - ссылка ответила только после повторных запросов
+	FindingFlaky = "flaky link"
+	// FindingCrawlTrap - ссылки образуют бесконечное пространство URL и не сканируются
+	FindingCrawlTrap = "crawl trap"
+)
+
 // Service это служба поискового робота
 type Service struct {
 	// Список просканированных сайтов
@@ -22,21 +85,98 @@ type Service struct {
 	// Канал для результатов сканирования
 	ChResults chan ScanResult
 	Errors    map[string]ErrorResult
+	// Пропущенные ссылки
+	Skipped map[string]SkipResult
+	// Замечания, не являющиеся ошибками сканирования
+	Findings []Finding
+	// Проблемы TLS-сертификатов хостов
+	Certificates []CertificateIssue
+	// Причина досрочной остановки сканирования, например исчерпанный бюджет
+	StopReason string
+	// Имя расписания, по которому запущено сканирование (пусто для сканирований, запущенных по команде)
+	Schedule string
 	// Текущее состояние
 	currentState int
 	// Команда
 	Cmd int
-	// Задержка, ms
-	Delay        int
+	// Количество параллельных обработчиков
+	Workers      int
 	ID           int
 	chReport     chan *Service
 	URLs         []string
-	excludedURLs map[string]bool
 	logger       *logger.Logger
 	TimeElapsed  time.Duration
 	TimeFinished time.Time
-	sessionName  string
-	cookies      map[string][]*http.Cookie
+	// Хранилище cookie
+	cookies *cookieJar
+	// Очередь ссылок, ожидающих сканирования
+	frontier *frontier
+	// Ограничитель нагрузки на хосты
+	limiter *limiter
+	// Настройки перенаправлений
+	redirects redirectPolicy
+	// Политика повторов запросов
+	retries retryPolicy
+	// Правила классификации ссылок
+	rules []rule
+	// Нормализатор URL
+	normalizer Normalizer
+	// Область сканирования
+	scope scope
+	// Детектор ловушек
+	traps *trapDetector
+	// Бюджеты сканирования
+	budget *budget
+	// HTTP-клиент, общий для всех запросов сканирования, и исполнитель его запросов
+	client  *http.Client
+	fetcher Fetcher
+	// Подмены адресов хостов и правила замены URL перед запросом
+	overrides *hostOverrides
+	rewrites  []rewriteRule
+	// Выбор метода запроса
+	methods methodPolicy
+	// Проверка сертификатов хостов
+	certs *certAudit
+	// Способы авторизации из конфигурации и используемые в сканировании
+	credentials map[string]*conf.Credentials
+	auth        []*credential
+	// Бюджет ошибок: при превышении сканирование прерывается (отрицательное значение снимает ограничение)
+	maxErrors int
+	// Параметры сканирования
+	sched conf.ScheduleData
+	// Время начала сканирования (для продолженного сканирования - с учетом времени до прерывания)
+	started time.Time
+	// Каталог для сохранения состояния сканирования, интервал сохранения и ключ файла состояния
+	stateDir           string
+	checkpointInterval time.Duration
+	checkpointKey      string
+	// Сканирование продолжено из файла состояния: cookie восстановлены из него
+	resumed bool
+	// Кэш robots.txt
+	robots *robots
+	// Не учитывать robots.txt
+	ignoreRobots bool
+	// Хосты стартовых URL, ссылки на них считаются внутренними
+	hosts map[string]bool
+	// Ссылки из sitemap: каноническая форма -> ссылка в том виде, в котором она указана в sitemap
+	sitemap map[string]string
+	// Ссылки, найденные на страницах сайта (заполняется только при сканировании sitemap)
+	linked map[string]bool
+	// Проверять ссылки на фрагменты страниц
+	checkFragments bool
+	// Проверять, не являются ли страницы страницами "не найдено" с кодом 200
+	checkSoft404 bool
+	soft404      *soft404Detector
+	// Якоря загруженных HTML-страниц
+	anchors map[string]map[string]bool
+	// Ссылки на фрагменты страниц: каноническая форма URL страницы -> фрагмент -> ссылки
+	fragments map[string]map[string]*fragmentRef
+	// Места, где найдены ссылки: каноническая форма ссылки -> места (nil - ссылка рабочая, места не нужны)
+	refs map[string][]LinkRef
+	// Канонические формы запрошенных ссылок, по ним отсеиваются повторы (Processed хранит ссылки в исходном виде)
+	visited map[string]bool
+	// Мьютекс защищает Processed, visited, Errors, currentState и Cmd
+	mux sync.RWMutex
 }
 
 // Статусы процесса
@@ -66,6 +206,24 @@ type ScanResult struct {
 	HTTPStatus    int
 	Error         string
 	ParentURL     string
+	Type          string
+	Skipped       string
+	Finding       string
+	Tag           string
+	Attr          string
+	Text          string
+	Line          int
+	Column        int
+	Page          int
+	Nofollow      bool
+	Parents       []LinkRef
+	Kind          string
+	Method        string
+	FinalURL      string
+	Redirects     []Redirect
+	Attempts      []Attempt
+	Retry         string
+	StopReason    string
 	ProgressState int
 	ID            int
 	TotalLinks    int
@@ -75,345 +233,833 @@ type ScanResult struct {
 
 // ErrorResult это структура, описывающая формат данных об ошибке сканирования
 type ErrorResult struct {
+	// Тип ошибки, пустой для недоступных ссылок
+	Type       string
 	HTTPStatus int
 	Error      string
 	ParentURL  string
-	depth      int
+	// Тег и атрибут, из которых получена ссылка
+	Tag  string
+	Attr string
+	// Текст ссылки или альтернативный текст изображения
+	Text string `json:",omitempty"`
+	// Строка и столбец тега в исходном коде HTML-страницы, строка или страница документа Markdown, текста или PDF
+	Line   int `json:",omitempty"`
+	Column int `json:",omitempty"`
+	Page   int `json:",omitempty"`
+	// У ссылки атрибут rel="nofollow"
+	Nofollow bool `json:",omitempty"`
+	// Все страницы, на которых найдена ссылка (не больше maxLinkRefs)
+	Parents []LinkRef `json:",omitempty"`
+	// Описание ссылки для отчетов, например "background image"
+	Kind string
+	// Метод запроса, по ответу на который ссылка признана битой
+	Method string
+	// Конечный URL и цепочка перенаправлений, если они были
+	FinalURL  string
+	Redirects []Redirect
+	// История попыток запроса и ее описание, например "failed 3/3 attempts"
+	Attempts []Attempt
+	Retry    string
+}
+
+// LinkRef это место, где найдена ссылка: страница, текст ссылки, тег и атрибут, позиция в исходном коде
+type LinkRef struct {
+	ParentURL string
+	Text      string `json:",omitempty"`
+	Tag       string `json:",omitempty"`
+	Attr      string `json:",omitempty"`
+	Line      int    `json:",omitempty"`
+	Column    int    `json:",omitempty"`
+	Page      int    `json:",omitempty"`
+	Nofollow  bool   `json:",omitempty"`
+}
+
+// SkipResult это структура, описывающая пропущенную ссылку
+type SkipResult struct {
+	Reason    string
+	ParentURL string
+}
+
+// Finding это структура, описывающая замечание по ссылке
+type Finding struct {
+	Category   string
+	URL        string
+	HTTPStatus int
+	Message    string
+	ParentURL  string
+	// Конечный URL и цепочка перенаправлений, если они были
+	FinalURL  string
+	Redirects []Redirect
 }
 
 // New возвращает новый объект службы поискового робота
-func New(ID int, delay int, chReport chan *Service, logger *logger.Logger) *Service {
+func New(ID int, cfg *conf.Config, chReport chan *Service, logger *logger.Logger) *Service {
 	var s Service
 	s.ID = ID
 	s.Processed = make(map[string]bool)
+	s.visited = make(map[string]bool)
 	s.ChResults = make(chan ScanResult)
 	s.Errors = make(map[string]ErrorResult)
+	s.Skipped = make(map[string]SkipResult)
+	s.Findings = make([]Finding, 0)
+	s.Certificates = make([]CertificateIssue, 0)
 	s.currentState = STOPPED
 	s.Cmd = 0
-	s.Delay = delay
+	s.Workers = cfg.Crawler.Workers
+	if s.Workers <= 0 {
+		s.Workers = defaultWorkers
+	}
 	s.chReport = chReport
 	s.URLs = make([]string, 0, 2)
-	s.excludedURLs = make(map[string]bool)
-	s.cookies = make(map[string][]*http.Cookie)
+	s.cookies = newCookieJar()
+	s.frontier = newFrontier(cfg.Crawler.MaxQueue)
+	s.limiter = newLimiter(cfg)
+	s.redirects = newRedirectPolicy(cfg.Crawler)
+	s.retries = newRetryPolicy(cfg.Crawler, cfg.Retry)
+	s.overrides = newHostOverrides()
+	if err := s.overrides.add(cfg.HTTP.Resolve); err != nil {
+		logger.Error(fmt.Sprintf("Resolve settings are ignored: %v", err))
+		s.overrides = newHostOverrides()
+	}
+	rewrites, err := parseRewrites(cfg.HTTP.Rewrite)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Rewrite rules are ignored: %v", err))
+	}
+	s.rewrites = rewrites
+	s.client = s.newHTTPClient(cfg.HTTP)
+	s.certs = newCertAudit(cfg.HTTP, s.fetcher)
+	s.normalizer = NewNormalizer(cfg.Normalize)
+	s.traps = newTrapDetector(cfg.Crawler)
+	s.soft404 = newSoft404Detector(cfg.Crawler)
+	s.budget = &budget{hostPages: make(map[string]int)}
+	rules, err := compileRules(cfg.Rule)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Rules are ignored: %v", err))
+		rules = defaultRules
+	}
+	s.rules = rules
+	methods, err := newMethodPolicy(cfg)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Request method settings are ignored: %v", err))
+		methods, _ = newMethodPolicy(&conf.Config{})
+	}
+	s.methods = methods
+	s.credentials = cfg.Credentials
+	s.maxErrors = cfg.Crawler.MaxErrors
+	if s.maxErrors == 0 {
+		s.maxErrors = defaultMaxErrors
+	}
+	s.stateDir = cfg.Crawler.StateDir
+	if s.stateDir == "" {
+		s.stateDir = defaultStateDir
+	}
+	s.checkpointInterval = time.Duration(cfg.Crawler.CheckpointInterval) * time.Second
+	if cfg.Crawler.CheckpointInterval == 0 {
+		s.checkpointInterval = defaultCheckpointInterval
+	}
+	s.robots = newRobots(cfg.Crawler.RobotsUserAgent)
+	s.hosts = make(map[string]bool)
+	s.sitemap = make(map[string]string)
+	s.linked = make(map[string]bool)
+	s.anchors = make(map[string]map[string]bool)
+	s.fragments = make(map[string]map[string]*fragmentRef)
+	s.refs = make(map[string][]LinkRef)
 	s.logger = logger
 	return &s
 }
 
 // Command принимает команду в строковом виде
 func (s *Service) Command(cmd string) error {
+	var c int
 	switch strings.ToUpper(cmd) {
 	case "PAUSE":
-		s.Cmd = PAUSE
+		c = PAUSE
 	case "PROCEED":
-		s.Cmd = PROCEED
+		c = PROCEED
 	case "CANCEL":
-		s.Cmd = CANCEL
+		c = CANCEL
 	default:
 		return errors.New("Unknown crawler command: " + cmd)
 	}
-	s.logger.Info(fmt.Sprintf("Command %v %v", cmd, s.Cmd))
+	s.mux.Lock()
+	s.Cmd = c
+	s.mux.Unlock()
+	s.logger.Info(fmt.Sprintf("Command %v %v", cmd, c))
 	s.updateState()
 	return nil
 }
 
 // updateState обновляет текущее состояние процесса
 func (s *Service) updateState() {
+	s.mux.Lock()
 	if s.Cmd == 0 {
+		s.mux.Unlock()
 		return
 	}
 	switch s.Cmd {
 	case PAUSE:
 		if s.currentState == INPROGRESS {
 			s.currentState = PAUSED
+			s.budget.pausedAt = time.Now()
 		}
 	case PROCEED:
 		if s.currentState == PAUSED {
 			s.currentState = INPROGRESS
+			s.budget.paused += time.Since(s.budget.pausedAt)
+			s.budget.pausedAt = time.Time{}
 		}
 	case CANCEL:
 		s.currentState = STOPPED
 	}
-	s.ChResults <- ScanResult{ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors)}
 	s.Cmd = 0
+	s.mux.Unlock()
+	s.publish(ScanResult{})
+}
+
+// state возвращает текущее состояние процесса
+func (s *Service) state() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.currentState
+}
+
+// State возвращает текущее состояние процесса: STOPPED, INPROGRESS или PAUSED
+func (s *Service) State() int {
+	return s.state()
+}
+
+// setState устанавливает текущее состояние процесса
+func (s *Service) setState(state int) {
+	s.mux.Lock()
+	s.currentState = state
+	s.mux.Unlock()
+}
+
+// CurrentErrors возвращает копию списка ошибок, найденных к текущему моменту
+func (s *Service) CurrentErrors() map[string]ErrorResult {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	errs := make(map[string]ErrorResult, len(s.Errors))
+	for u, e := range s.Errors {
+		errs[u] = e
+	}
+	return errs
+}
+
+// errorsCount возвращает количество ошибок, найденных к текущему моменту
+func (s *Service) errorsCount() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return len(s.Errors)
+}
+
+// publish дополняет сообщение текущим состоянием процесса и отправляет его в канал результатов
+func (s *Service) publish(r ScanResult) {
+	s.mux.RLock()
+	r.ProgressState = s.currentState
+	r.ID = s.ID
+	r.TotalLinks = len(s.Processed)
+	r.TotalErrors = len(s.Errors)
+	r.URLs = s.URLs
+	r.StopReason = s.StopReason
+	s.mux.RUnlock()
+	s.ChResults <- r
+}
+
+// addError сохраняет ошибку сканирования ссылки и отправляет ее в канал результатов
+func (s *Service) addError(link string, e ErrorResult) {
+	s.mux.Lock()
+	if e.Parents == nil {
+		e.Parents = append([]LinkRef(nil), s.refs[s.canonical(link)]...)
+	}
+	s.Errors[link] = e
+	s.mux.Unlock()
+	s.publish(ScanResult{URL: link, Type: e.Type, HTTPStatus: e.HTTPStatus, Error: e.Error, ParentURL: e.ParentURL, Tag: e.Tag, Attr: e.Attr,
+		Text: e.Text, Line: e.Line, Column: e.Column, Page: e.Page, Nofollow: e.Nofollow, Parents: e.Parents, Kind: e.Kind, Method: e.Method, FinalURL: e.FinalURL, Redirects: e.Redirects, Attempts: e.Attempts, Retry: e.Retry})
+}
+
+// addRef запоминает место ссылки с канонической формой key. Места рабочих ссылок не запоминаются.
+// Вызывается под s.mux
+func (s *Service) addRef(key string, ref LinkRef) {
+	refs, ok := s.refs[key]
+	if ok && refs == nil || len(refs) >= maxLinkRefs {
+		return
+	}
+	s.refs[key] = append(refs, ref)
+}
+
+// updateParents дополняет ошибки местами ссылок, найденными после того, как ошибка была опубликована
+func (s *Service) updateParents() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for link, e := range s.Errors {
+		if refs := s.refs[s.canonical(link)]; len(refs) > len(e.Parents) {
+			e.Parents = append([]LinkRef(nil), refs...)
+			s.Errors[link] = e
+		}
+	}
+}
+
+// errorResult возвращает описание ошибки сканирования ссылки t
+func (s *Service) errorResult(t task, status int, err string) ErrorResult {
+	return ErrorResult{HTTPStatus: status, Error: err, ParentURL: t.baseLink, Tag: t.tag, Attr: t.attr, Text: t.text, Line: t.line, Column: t.column, Page: t.page,
+		Nofollow: t.nofollow, Kind: linkKind(t.tag, t.attr, t.link)}
+}
+
+// skip сохраняет пропущенную ссылку и отправляет ее в канал результатов
+func (s *Service) skip(link string, r SkipResult) {
+	s.mux.Lock()
+	s.Skipped[link] = r
+	s.mux.Unlock()
+	s.publish(ScanResult{URL: link, Skipped: r.Reason, ParentURL: r.ParentURL})
+}
+
+// addFinding сохраняет замечание и отправляет его в канал результатов
+func (s *Service) addFinding(f Finding) {
+	s.mux.Lock()
+	s.Findings = append(s.Findings, f)
+	s.mux.Unlock()
+	s.publish(ScanResult{URL: f.URL, HTTPStatus: f.HTTPStatus, Error: f.Message, ParentURL: f.ParentURL, Finding: f.Category, FinalURL: f.FinalURL, Redirects: f.Redirects})
+}
+
+// internal проверяет, является ли ссылка внутренней, т.е. ведет на хост одного из стартовых URL
+func (s *Service) internal(u *url.URL) bool {
+	return s.hosts[strings.ToLower(u.Host)]
 }
 
 // Scan запускает сканирование сайта
-// Параметры:
-// - url: URL сайта,
-// - depth: глубина сканирования (-1 снимает ограничение),
-// - cmd: канал с командами
-// Возвращает канал с успешными ссылками и канал с ошибками.
-func (s *Service) Scan(urls []string, depth int, sessionName string, excludedURLs []string) {
-	started := time.Now()
-	s.logger.Info(fmt.Sprintf("Started, ID: %d...", s.ID))
-	s.currentState = INPROGRESS
-	s.ChResults <- ScanResult{ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors)}
-	s.sessionName = sessionName
-	if len(excludedURLs) > 0 {
-		for _, u := range excludedURLs {
-			s.excludedURLs[u] = true
+// Параметры сканирования (sched):
+// - URL: список URL сайтов,
+// - Depth: глубина сканирования (-1 снимает ограничение),
+// - SessionName: имя cookie сессии,
+// - Cookies, CookieFile, SaveCookies: режим работы с cookie, файл cookies.txt для начального заполнения хранилища
+// и сохранение хранилища в этот файл по окончании сканирования,
+// - ExcludedURL: список URL, исключенных из сканирования,
+// - Include, Exclude: шаблоны области сканирования (ссылки вне области попадают в отчет как пропущенные),
+// - IgnoreRobots: не учитывать robots.txt,
+// - Sitemap: дополнить список ссылок для сканирования ссылками из sitemap (SitemapURL или найденных автоматически),
+// - CheckFragments: проверять, что на страницах есть якоря, на которые ведут ссылки вида page.html#section,
+// - Soft404: проверять, не являются ли страницы с кодом 200 страницами "не найдено",
+// - MaxErrors: бюджет ошибок, после превышения которого сканирование прерывается (-1 снимает ограничение),
+// - Credentials: способы авторизации на сайтах,
+// - Resolve, Rewrite: подмены адресов хостов и правила замены URL перед запросом,
+// - Record, Replay: запись запросов сканирования в архив HAR или воспроизведение сканирования из архива без сети,
+// - Dir: каталог, файлы которого отдаются вместо запросов ссылок первого URL.
+// Результаты сканирования пишутся в канал ChResults, по окончании сканирования служба отправляется в канал отчетов.
+// Состояние сканирования периодически сохраняется на диск, прерванное сканирование продолжается методом Resume
+// по ключу файла состояния.
+func (s *Service) Scan(sched conf.ScheduleData) {
+	s.started = time.Now()
+	s.checkpointKey = checkpointKey(s.Schedule, sched.URL, s.started)
+	s.logger.Info(fmt.Sprintf("Started, ID: %d, workers: %d...", s.ID, s.Workers))
+	if err := s.setup(sched); err != nil {
+		s.logger.Error(fmt.Sprintf("Setup, ID: %d: %v", s.ID, err))
+		s.stop(err.Error())
+		s.finish()
+		return
+	}
+	seeds := make([]task, 0, len(sched.URL))
+	for _, link := range sched.URL {
+		seeds = append(seeds, task{link: link, baseLink: link, depth: sched.Depth, key: s.canonical(link)})
+	}
+	if sched.Sitemap {
+		for _, t := range seeds {
+			s.linked[t.key] = true
 		}
+		seeds = append(seeds, s.sitemapSeeds(sched.URL, sched.SitemapURL, sched.Depth)...)
 	}
-	for _, url := range urls {
-		s.URLs = append(s.URLs, url)
-		s.ChResults <- ScanResult{ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
-		s.parse(url, url, depth)
+	for _, t := range seeds {
+		s.enqueue(t)
 	}
-	// Re-scan errors
-	var savedDelay int
-	savedDelay, s.Delay = s.Delay, 3
-	for u, e := range s.Errors {
-		// Re-scan only errors with code 0 and >= 500
-		if e.HTTPStatus > 0 && e.HTTPStatus < 500 {
-			continue
+	s.run()
+	s.finish()
+}
+
+// setup применяет параметры сканирования и переводит процесс в состояние INPROGRESS.
+// Ошибка означает, что сканирование начинать нельзя
+func (s *Service) setup(sched conf.ScheduleData) error {
+	s.sched = sched
+	s.setState(INPROGRESS)
+	s.publish(ScanResult{})
+	s.ignoreRobots = sched.IgnoreRobots
+	s.checkFragments = sched.CheckFragments
+	s.checkSoft404 = sched.Soft404
+	if sched.MaxErrors != 0 {
+		s.maxErrors = sched.MaxErrors
+	}
+	s.budget.setLimits(sched)
+	sc, err := newScope(sched)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Scope, ID: %d: %v", s.ID, err))
+	}
+	s.scope = sc
+	for _, link := range sched.URL {
+		if u, err := url.Parse(link); err == nil {
+			s.hosts[strings.ToLower(u.Host)] = true
 		}
-		s.logger.Info(fmt.Sprintf("Re-scan %s", u))
-		s.parse(u, e.ParentURL, e.depth)
+		s.mux.Lock()
+		s.URLs = append(s.URLs, link)
+		s.mux.Unlock()
+		s.publish(ScanResult{})
+	}
+	if err := s.setupFetcher(sched); err != nil {
+		return err
+	}
+	s.setupOverrides(sched)
+	s.setupCookies(sched)
+	if len(sched.Credentials) > 0 {
+		s.setupAuth(sched.Credentials)
+	}
+	return nil
+}
+
+// finish выполняет проверки по итогам сканирования, удаляет сохраненное состояние и отправляет службу в канал отчетов
+func (s *Service) finish() {
+	if s.checkFragments {
+		s.fragmentErrors()
+	}
+	if s.sched.Sitemap {
+		s.sitemapFindings()
+	}
+	s.updateParents()
+
+	s.setState(STOPPED)
+	s.publish(ScanResult{})
+	s.removeCheckpoint()
+	s.saveCookies()
+	if err := s.fetcher.Close(); err != nil {
+		s.logger.Error(fmt.Sprintf("Fetcher, ID: %d: %v", s.ID, err))
 	}
-	s.Delay = savedDelay
-	s.currentState = STOPPED
-	s.ChResults <- ScanResult{ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
 	s.logger.Info(fmt.Sprintf("Finished, ID: %d...", s.ID))
 	s.TimeFinished = time.Now()
-	s.TimeElapsed = s.TimeFinished.Sub(started)
+	s.TimeElapsed = s.TimeFinished.Sub(s.started)
 
 	s.chReport <- s
 }
 
-func (s *Service) parse(link string, baseLink string, depth int) {
+// enqueue добавляет ссылку в очередь без повторов по канонической форме.
+// Ссылка, не поместившаяся в очередь, попадает в отчет как пропущенная
+func (s *Service) enqueue(t task) {
+	if _, err := s.frontier.push(t); err == errQueueFull {
+		s.skip(t.link, SkipResult{Reason: SkippedQueueFull, ParentURL: t.baseLink})
+	}
+}
 
-	if len(s.Errors) > 35 {
-		s.currentState = STOPPED
-		return
+// run сканирует ссылки из очереди пулом из s.Workers обработчиков, пока очередь не опустеет
+// или процесс не будет остановлен.
+// Очередью владеет только диспетчер (текущая горутина): он раздает ссылки обработчикам через
+// ограниченный канал и добавляет в очередь найденные ими ссылки.
+func (s *Service) run() {
+	workers := s.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	chTasks := make(chan task, workers)
+	chFound := make(chan taskResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go s.worker(chTasks, chFound, &wg)
 	}
 
-	if s.currentState == PAUSED {
-		start := time.Now()
-		for s.currentState == PAUSED {
-			// Ожидание завершения паузы
-			time.Sleep(time.Second * 1)
-			// Каждые 5 секунд пишем в канал результатов текущее состояние
-			if int(time.Since(start).Seconds())%5 == 0 {
-				s.ChResults <- ScanResult{ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var pausedAt time.Time
+	savedAt := time.Now()
+	// Ссылки, переданные обработчикам и еще не обработанные
+	inFlight := make(map[string]task)
+	// Таймер, срабатывающий, когда освобождается хост, ссылки которого не раздаются
+	var wakeTimer *time.Timer
+	var wakeAt time.Time
+	for {
+		if s.state() != STOPPED {
+			if reason := s.exhausted(); reason != "" {
+				s.stop(reason)
+			}
+		}
+		state := s.state()
+		if len(inFlight) == 0 && (state == STOPPED || (state == INPROGRESS && s.frontier.len() == 0)) {
+			break
+		}
+		if state != PAUSED {
+			pausedAt = time.Time{}
+		} else if pausedAt.IsZero() {
+			// Приостановленный процесс может быть прерван перезапуском, сохраняем состояние сразу
+			pausedAt = time.Now()
+			s.checkpoint(inFlight)
+			savedAt = pausedAt
+		}
+
+		// Новые ссылки раздаем только пока процесс идет
+		var out chan task
+		var next task
+		var pos int
+		now := time.Now()
+		if state == INPROGRESS {
+			// Ссылки хостов, к которым пока нельзя отправить запрос, пропускаем, чтобы не занимать ими обработчики
+			if i, ok := s.frontier.peek(now); ok {
+				out, next, pos = chTasks, s.frontier.at(i), i
 			}
-			// Через час снимаем с паузы и завершаем процесс
-			if int(time.Since(start).Hours()) >= 1 {
-				s.currentState = STOPPED
-				break
+		}
+		if at := s.frontier.wake(now); !at.IsZero() && !at.Equal(wakeAt) {
+			if wakeTimer != nil {
+				wakeTimer.Stop()
+			}
+			wakeTimer, wakeAt = time.NewTimer(at.Sub(now)), at
+		}
+		var wake <-chan time.Time
+		if wakeTimer != nil {
+			wake = wakeTimer.C
+		}
+
+		select {
+		case out <- next:
+			s.frontier.take(pos)
+			inFlight[next.id()] = next
+		case r := <-chFound:
+			delete(inFlight, r.t.id())
+			if r.wait > 0 {
+				s.frontier.postpone(r.t, time.Now().Add(r.wait))
+			}
+			for _, t := range r.found {
+				s.enqueue(t)
+			}
+		case <-wake:
+			wakeTimer, wakeAt = nil, time.Time{}
+		case <-ticker.C:
+			if s.checkpointInterval > 0 && time.Since(savedAt) >= s.checkpointInterval {
+				s.checkpoint(inFlight)
+				savedAt = time.Now()
+			}
+			if state != PAUSED {
+				continue
+			}
+			// Каждые 5 секунд пишем в канал результатов текущее состояние
+			if int(time.Since(pausedAt).Seconds())%5 == 0 {
+				s.publish(ScanResult{})
 			}
 		}
 	}
+	close(chTasks)
+	wg.Wait()
+}
 
-	if s.currentState == STOPPED {
-		return
+// taskResult это результат сканирования ссылки: сама ссылка и ссылки, найденные на странице
+type taskResult struct {
+	t     task
+	found []task
+	// Пауза, на которую ссылка отложена, если к ее хосту пока нельзя отправить запрос
+	wait time.Duration
+}
+
+// worker получает ссылки из канала chTasks, сканирует их и пишет найденные на странице ссылки в канал chFound
+func (s *Service) worker(chTasks <-chan task, chFound chan<- taskResult, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for t := range chTasks {
+		found, wait := s.parse(t)
+		chFound <- taskResult{t: t, found: found, wait: wait}
 	}
+}
 
-	if depth == 0 {
-		return
+// parse сканирует ссылку и возвращает список ссылок, найденных на странице (HTML или CSS), для дальнейшего сканирования.
+// Если запрос к хосту ссылки сейчас отправить нельзя, ссылка не сканируется и возвращается пауза,
+// на которую ее нужно отложить, чтобы обработчик не простаивал в ожидании хоста
+func (s *Service) parse(t task) ([]task, time.Duration) {
+	if s.state() == STOPPED {
+		return nil, 0
 	}
 
-	// Delay
-	time.Sleep(time.Millisecond * time.Duration(s.Delay))
+	if t.depth == 0 {
+		return nil, 0
+	}
+	link, baseLink := t.link, t.baseLink
+
+	parsedLink, err := url.Parse(link)
+	if err != nil {
+		return nil, 0
+	}
+	host := parsedLink.Hostname()
 
-	s.Processed[link] = true
+	// Ссылки вне области сканирования не сканируем, стартовые URL проверяем всегда
+	if !s.seed(link) && !s.inScope(parsedLink) {
+		s.skip(link, SkipResult{Reason: SkippedOutOfScope, ParentURL: baseLink})
+		return nil, 0
+	}
 
-	// To skip SSL certificate issues
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	// Внутренние ссылки, запрещенные в robots.txt, не сканируем
+	if !s.ignoreRobots && s.internal(parsedLink) && !s.robotsAllowed(parsedLink) {
+		s.skip(link, SkipResult{Reason: SkippedByRobots, ParentURL: baseLink})
+		return nil, 0
+	}
+	// Ссылки выхода с сайта не запрашиваем, чтобы не потерять сессию
+	if s.logoutLink(parsedLink) {
+		s.skip(link, SkipResult{Reason: SkippedLogout, ParentURL: baseLink})
+		return nil, 0
+	}
+	// Ссылки, игнорируемые правилами независимо от ответа, не запрашиваем
+	if r, ok := s.ignoredRule(parsedLink); ok {
+		s.applyRule(t, r, ErrorResult{})
+		return nil, 0
 	}
-	// Set client's timeout and transport
-	client := &http.Client{
-		Timeout:   15 * time.Second,
-		Transport: tr,
+	// Если хост занят или выдерживается пауза до следующего запроса к нему, ссылка откладывается
+	if d, ok := s.limiter.tryAcquire(host); !ok {
+		return nil, d
 	}
+	defer s.limiter.release(host)
+	// Бюджет проверяем непосредственно перед запросом, чтобы пропущенные ссылки его не расходовали
+	if !s.reserve(t, host) {
+		return nil, 0
+	}
+
 	// Detect request method (GET or HEAD)
-	method := method(link)
+	method, forced := s.methods.method(parsedLink)
 
 	// Make request
 	request, err := http.NewRequest(method, link, nil)
 	if err != nil {
-		s.Errors[link] = ErrorResult{HTTPStatus: 0, Error: fmt.Sprintf("%v", err), ParentURL: baseLink}
-		s.ChResults <- ScanResult{URL: link, HTTPStatus: 0, Error: fmt.Sprintf("%v", err), ParentURL: baseLink, ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
-		return
+		s.addError(link, s.errorResult(t, 0, fmt.Sprintf("%v", err)))
+		return nil, 0
 	}
 
-	request.Header.Add("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.104 Safari/537.36")
+	request.Header.Add("User-Agent", userAgent)
 	request.Header.Add("Accept", "*/*")
 	//request.Header.Add("Accept-Encoding", "gzip, deflate, br")
 	request.Header.Add("Connection", "keep-alive")
 
-	parsedLink, err := url.Parse(link)
-	if err != nil {
-		return
+	cred, generation := s.authorize(request)
+	// Копия запроса до отправки нужна, чтобы повторить его после повторного входа
+	retryRequest := request.Clone(request.Context())
+	response, method, attempts, err := s.fetch(request, t, forced, host)
+	// Сессия потеряна: входим заново и повторяем запрос (это не повтор после ошибки, история попыток начинается заново)
+	if err == nil && cred != nil && cred.loggedOut(parsedLink, response) && s.relogin(cred, generation, host) {
+		response.Body.Close()
+		s.limiter.release(host)
+		s.limiter.acquire(host)
+		response, method, attempts, err = s.fetch(retryRequest, t, forced, host)
 	}
-	host := parsedLink.Hostname()
-
-	if cookies, ok := s.cookies[host]; ok == true {
-		for _, c := range cookies {
-			request.AddCookie(c)
-		}
-	}
-	response, err := client.Do(request)
 	if err != nil {
-		s.Errors[link] = ErrorResult{HTTPStatus: 0, Error: fmt.Sprintf("%s error: %v", method, err), ParentURL: baseLink}
-		s.ChResults <- ScanResult{URL: link, HTTPStatus: 0, Error: fmt.Sprintf("%s error: %v", method, err), ParentURL: baseLink, ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
-		return
+		e := s.errorResult(t, 0, fmt.Sprintf("%s error: %v", method, err))
+		e.Method, e.Attempts, e.Retry = method, attempts, s.retries.summary(attempts, true)
+		if errors.Is(err, errRedirectLoop) {
+			e.Type = ErrorTypeRedirectLoop
+		}
+		s.applyRule(t, s.classify(parsedLink, 0, nil), e)
+		return nil, 0
 	}
 	defer response.Body.Close()
+	s.auditCertificates(response)
 
-	if response.StatusCode == 403 && response.Header.Get("Cf-Chl-Bypass") == "1" {
-		err := "Protected by CloudFlare CAPTCHA"
-		s.Errors[link] = ErrorResult{HTTPStatus: response.StatusCode, Error: err, ParentURL: baseLink, depth: depth}
-		s.ChResults <- ScanResult{URL: link, HTTPStatus: response.StatusCode, Error: err, ParentURL: baseLink, ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
-		return
+	e := withRedirects(s.errorResult(t, response.StatusCode, response.Status), response)
+	e.Method, e.Attempts, e.Retry = method, attempts, s.retries.summary(attempts, true)
+	if !s.applyRule(t, s.classify(parsedLink, response.StatusCode, response.Header), e) {
+		return nil, 0
 	}
 
-	if response.StatusCode > 400 && response.StatusCode != 418 && response.StatusCode != 429 {
-		s.Errors[link] = ErrorResult{HTTPStatus: response.StatusCode, Error: response.Status, ParentURL: baseLink, depth: depth}
-		s.ChResults <- ScanResult{URL: link, HTTPStatus: response.StatusCode, Error: response.Status, ParentURL: baseLink, ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
-		return
+	docType := response.Header.Get("Content-type")
+	// HTML-страница разбирается до публикации результата: она может оказаться страницей "не найдено"
+	var page *html.Node
+	// Исходный код страницы нужен, чтобы указать позиции ссылок
+	var source []byte
+	if s.checkSoft404 && method == "GET" && response.StatusCode == http.StatusOK && strings.Contains(docType, "text/html") {
+		if page, source, err = parsePage(response.Body); err != nil {
+			return nil, 0
+		}
+		if score, reason, soft := s.soft404Check(parsedLink, response, page); soft {
+			e.Type = ErrorTypeSoft404
+			e.Error = fmt.Sprintf("Soft 404 (score %.2f): %s", score, reason)
+			s.addError(link, e)
+			return nil, 0
+		}
 	}
 
 	// Success
-	s.ChResults <- ScanResult{URL: link, State: 1, HTTPStatus: response.StatusCode, ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
-	if _, ok := s.Errors[link]; ok {
-		delete(s.Errors, link)
+	s.mux.Lock()
+	delete(s.Errors, link)
+	// Места рабочей ссылки в отчете не нужны
+	s.refs[t.id()] = nil
+	_, listed := s.sitemap[t.id()]
+	s.mux.Unlock()
+	chain := redirectChain(response)
+	finalURL := response.Request.URL.String()
+	if len(chain) == 0 {
+		finalURL = ""
 	}
+	retry := s.retries.summary(attempts, false)
+	s.publish(ScanResult{URL: link, State: 1, HTTPStatus: response.StatusCode, Method: method, FinalURL: finalURL, Redirects: chain, Attempts: attempts, Retry: retry})
 
-	if depth == 1 {
-		return
-	}
-
-	docType := response.Header.Get("Content-type")
-	if !strings.Contains(docType, "text/html") {
-		return
+	if retry != "" {
+		tail := lastMethodAttempts(attempts)
+		s.addFinding(Finding{Category: FindingFlaky, URL: link, HTTPStatus: response.StatusCode, Message: "Recovered on retry " + strconv.Itoa(len(tail)-1) + " after " + tail[0].Error, ParentURL: baseLink})
 	}
 
-	// Парсим только если вернулся HTML
-	page, err := html.Parse(response.Body)
-	if err != nil {
-		// Не смогли распарсить, ну и ладно, выходим
-		return
+	s.redirectFindings(t, chain, finalURL, response.StatusCode)
+	// Ссылки из sitemap должны вести на конечный адрес страницы
+	if listed && len(chain) > 0 {
+		s.addFinding(Finding{Category: FindingSitemap, URL: link, HTTPStatus: response.StatusCode, Message: "Listed in sitemap but redirects to " + finalURL, FinalURL: finalURL, Redirects: chain})
 	}
 
-	if s.sessionName != "" {
-		if _, ok := s.cookies[host]; ok == false {
-			for _, c := range response.Cookies() {
-				if c.Name == s.sessionName {
-					s.cookies[host] = append(s.cookies[host], c)
-				}
+	if t.depth == 1 {
+		// Ссылки со страницы не сканируем, но собираем ее якоря для проверки фрагментов
+		if s.checkFragments && method == "GET" && strings.Contains(docType, "text/html") {
+			if page == nil {
+				page, err = html.Parse(response.Body)
+			}
+			if err == nil {
+				s.setAnchors(t.id(), pageAnchors(page))
 			}
 		}
+		return nil, 0
 	}
 
 	// Парсим базовый URL
-	base, err := url.Parse(baseLink)
+	base, err := url.Parse(t.baseLink)
 	if err != nil {
 		// Ошибка парсинга базового URL - странная ситуация, пропускаем ход, но пишем в канал ошибок
-		s.Errors[link] = ErrorResult{Error: fmt.Sprintf("URL parse error: %v", err), ParentURL: baseLink, depth: depth}
-		s.ChResults <- ScanResult{URL: link, Error: fmt.Sprintf("URL parse error: %v", err), ParentURL: baseLink, ProgressState: s.currentState, ID: s.ID, TotalLinks: len(s.Processed), TotalErrors: len(s.Errors), URLs: s.URLs}
-		return
+		s.addError(t.link, s.errorResult(t, 0, fmt.Sprintf("URL parse error: %v", err)))
+		return nil, 0
 	}
+	base = s.dirBase(base, parsedLink, response, finalURL != "")
 
-	links := make(map[string]bool)
-	baseURI := pageLinks(links, page)
+	switch kind := documentType(docType, link); kind {
+	case docHTML:
+		// Парсим HTML, если страница еще не разобрана
+		if page == nil {
+			if page, source, err = parsePage(response.Body); err != nil {
+				// Не смогли распарсить, ну и ладно, выходим
+				return nil, 0
+			}
+		}
 
-	for l := range links {
-		u, err := url.Parse(l)
+		if s.checkFragments && method == "GET" {
+			s.setAnchors(t.id(), pageAnchors(page))
+		}
+
+		links, baseURI := pageLinks(page, source)
+		return s.newTasks(t, base, links, func(l string) (*url.URL, error) {
+			return resolveLink(l, base, baseURI)
+		}), 0
+
+	case docCSS:
+		// Ссылки в CSS-файле считаются относительно самого файла
+		css, err := ioutil.ReadAll(io.LimitReader(response.Body, maxCSSSize))
 		if err != nil {
-			// Ошибка парсинга URL - пропускаем ссылку и продолжаем дальше
-			continue
+			return nil, 0
 		}
-		if u.IsAbs() == true {
-			// Абсолютная ссылка - оставляем как есть
-
-		} else if strings.HasPrefix(l, "//") {
-			// Абсолютная ссылка вида "//foo", добавляем схему (http/https) из базового URL
-			u.Scheme = base.Scheme
-
-		} else if strings.HasPrefix(l, "/") {
-			// Относительная ссылка вида "/foo", добаввляем схему и хост из базового URL
-			u.Scheme = base.Scheme
-			u.Host = base.Host
-
-		} else {
-			// Остальные ссылки считаем относительными от текущего пути в базовом URL: "foo", "./foo" etc
-			// Добавляем схему, хост и path базового URL
-			// т.е. если базовый URL http://example.com/foo/test.html, а текущая ссылка "bar.html"
-			// ссылка будет превращена в http://example.com/foo/bar.html
-			u.Scheme = base.Scheme
-			u.Host = base.Host
-			p := path.Clean(u.Path)
-			if p == "." {
-				p = ""
+		return s.newTasks(t, base, cssLinks(string(css), "css"), func(l string) (*url.URL, error) {
+			u, err := url.Parse(l)
+			if err != nil {
+				return nil, err
 			}
-			basePath := base.Path
-			if baseURI != "" {
-				if bURL, err := url.Parse(baseURI); err == nil {
-					u.Scheme = bURL.Scheme
-					u.Host = bURL.Host
-					basePath = bURL.Path
+			return parsedLink.ResolveReference(u), nil
+		}), 0
+
+	case docMarkdown, docText, docPDF:
+		// Ссылки в документе тоже считаются относительно самого документа
+		return s.newTasks(t, base, documentLinks(kind, response.Body), func(l string) (*url.URL, error) {
+			u, err := url.Parse(l)
+			if err != nil {
+				return nil, err
+			}
+			return parsedLink.ResolveReference(u), nil
+		}), 0
+	}
+	return nil, 0
+}
+
+// newTasks возвращает ссылки, найденные на странице t, которые нужно сканировать.
+// Места запоминаются для каждого повтора ссылки на странице, а сканировать ссылка отдается один раз.
+// base - базовый URL страницы, resolve - функция, превращающая ссылку в абсолютный URL
+func (s *Service) newTasks(t task, base *url.URL, links []Link, resolve func(string) (*url.URL, error)) []task {
+	found := make([]task, 0, len(links))
+	scheduled := make(map[string]bool, len(links))
+	for _, l := range links {
+		// Ссылка на фрагмент текущей страницы
+		if strings.HasPrefix(l.URL, "#") {
+			if s.checkFragments {
+				if u, err := url.Parse(l.URL); err == nil {
+					s.addFragmentRef(t.id(), u.Fragment, t.link+l.URL, l.ref(t.link))
 				}
 			}
-			u.Path = strings.TrimRight(path.Dir(basePath), "/") + "/" + p
+			continue
+		}
+		u, err := resolve(l.URL)
+		if err != nil {
+			// Ошибка парсинга URL - пропускаем ссылку и продолжаем дальше
+			continue
+		}
+		// Повторы отсеиваем по канонической форме ссылки, в отчет попадает ссылка в том виде, в котором она указана на странице
+		key := s.normalizer.Normalize(u)
+		if s.checkFragments && u.Fragment != "" {
+			s.addFragmentRef(key, u.Fragment, u.String(), l.ref(t.link))
 		}
 		u.Fragment = ""
 		newURL := u.String()
-		// Ссылка уже отсканирована - пропускаем
-		if _, found := s.Processed[newURL]; found {
-			continue
+		s.mux.Lock()
+		if len(s.sitemap) > 0 {
+			s.linked[key] = true
 		}
-		if _, found := s.excludedURLs[newURL]; found {
+		s.addRef(key, l.ref(t.link))
+		// Ссылка уже отсканирована - пропускаем
+		processed := s.visited[key]
+		s.mux.Unlock()
+		if processed || scheduled[key] {
 			continue
 		}
-		newDepth := depth - 1
-		// Сканируем ссылки с других хостов только на глубину 1
-		if u.Host != base.Host {
+		scheduled[key] = true
+		newDepth := t.depth - 1
+		// Сканируем ссылки с других хостов только на глубину 1. Ссылки, попавшие в ловушку, тоже только проверяем,
+		// ссылки с их страниц не сканируем
+		if u.Host != base.Host || s.trapped(t, u, key) {
 			newDepth = 1
 		}
-		s.parse(newURL, link, newDepth)
-	}
-}
-
-func pageLinks(links map[string]bool, n *html.Node) string {
-	var base string
-	tagsAttr := map[string]string{
-		"a":      "href",
-		"link":   "href",
-		"script": "src",
-		"img":    "src",
-		"iframe": "src",
-		"base":   "href",
-	}
-	prohibitedPrefixes := []string{"tel:", "mailto:", "javascript:"}
-	if attr, ok := tagsAttr[n.Data]; ok && n.Type == html.ElementNode {
-		for _, a := range n.Attr {
-			if a.Key == attr {
-				allowed := true
-				for _, prefix := range prohibitedPrefixes {
-					if strings.HasPrefix(a.Val, prefix) {
-						allowed = false
-					}
-				}
-				if !allowed {
-					continue
-				}
-				if n.Data == "base" {
-					base = a.Val
-				}
-				if _, found := links[a.Val]; !found {
-					links[a.Val] = true
-				}
-			}
-		}
+		found = append(found, task{link: newURL, baseLink: t.link, depth: newDepth, tag: l.Tag, attr: l.Attr, text: l.Text, line: l.Line, column: l.Column,
+			page: l.Page, nofollow: l.Nofollow, key: key})
+	}
+	return found
+}
+
+// resolveLink превращает ссылку l со страницы в абсолютный URL.
+// base - базовый URL, baseURI - значение href тега <base> на странице
+func resolveLink(l string, base *url.URL, baseURI string) (*url.URL, error) {
+	u, err := url.Parse(l)
+	if err != nil {
+		return nil, err
 	}
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		rbase := pageLinks(links, c)
-		if rbase != "" {
-			base = rbase
+	if u.IsAbs() == true {
+		// Абсолютная ссылка - оставляем как есть
+
+	} else if strings.HasPrefix(l, "//") {
+		// Абсолютная ссылка вида "//foo", добавляем схему (http/https) из базового URL
+		u.Scheme = base.Scheme
+
+	} else if strings.HasPrefix(l, "/") {
+		// Относительная ссылка вида "/foo", добаввляем схему и хост из базового URL
+		u.Scheme = base.Scheme
+		u.Host = base.Host
+
+	} else {
+		// Остальные ссылки считаем относительными от текущего пути в базовом URL: "foo", "./foo" etc
+		// Добавляем схему, хост и path базового URL
+		// т.е. если базовый URL http://example.com/foo/test.html, а текущая ссылка "bar.html"
+		// ссылка будет превращена в http://example.com/foo/bar.html
+		u.Scheme = base.Scheme
+		u.Host = base.Host
+		p := path.Clean(u.Path)
+		if p == "." {
+			p = ""
+		}
+		basePath := base.Path
+		if baseURI != "" {
+			if bURL, err := url.Parse(baseURI); err == nil {
+				u.Scheme = bURL.Scheme
+				u.Host = bURL.Host
+				basePath = bURL.Path
+			}
 		}
+		u.Path = strings.TrimRight(path.Dir(basePath), "/") + "/" + p
 	}
-	return base
+	return u, nil
 }
 
 func method(link string) string {
@@ -424,6 +1070,7 @@ func method(link string) string {
 			".htm":  true,
 			".asp":  true,
 			".aspx": true,
+			".css":  true,
 		}
 		if _, ok := exts[ext(u.Path)]; ok == true {
 			return "GET"
@@ -3,13 +3,16 @@
 package crawler
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
+	"blc/pkg/conf"
 	"blc/pkg/logger"
 )
 
@@ -23,6 +26,52 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// testScan - итог тестового сканирования
+type testScan struct {
+	*Service
+	URL     string       // адрес тестового сервера
+	Results []ScanResult // все результаты, опубликованные в ChResults
+}
+
+// runScan сканирует sched новым сервисом с конфигурацией cfg и возвращает его после окончания сканирования.
+// Если передан handler, для сканирования запускается тестовый сервер, и адреса sched.URL,
+// начинающиеся с "/", считаются от его корня.
+func runScan(t *testing.T, cfg *conf.Config, handler http.Handler, sched conf.ScheduleData) *testScan {
+	t.Helper()
+	scan := &testScan{}
+	if handler != nil {
+		ts := httptest.NewServer(handler)
+		t.Cleanup(ts.Close)
+		scan.URL = ts.URL
+		urls := make([]string, len(sched.URL))
+		for i, link := range sched.URL {
+			if strings.HasPrefix(link, "/") {
+				link = ts.URL + link
+			}
+			urls[i] = link
+		}
+		sched.URL = urls
+	}
+	if cfg == nil {
+		cfg = &conf.Config{}
+	}
+
+	chReport := make(chan *Service, 1)
+	scan.Service = New(1, cfg, chReport, logger.New(ioutil.Discard, ioutil.Discard))
+	done := make(chan bool)
+	go func() {
+		for r := range scan.ChResults {
+			scan.Results = append(scan.Results, r)
+		}
+		done <- true
+	}()
+	scan.Scan(sched)
+	<-chReport
+	close(scan.ChResults)
+	<-done
+	return scan
+}
+
 func TestService_parse(t *testing.T) {
 
 	// Тестовая страница заведена специально для тестирования пакета spider,
@@ -34,7 +83,7 @@ func TestService_parse(t *testing.T) {
 
 	l := logger.New(os.Stdout, os.Stderr)
 
-	s := New(1, 100, chReport, l)
+	s := New(1, &conf.Config{Crawler: conf.Crawler{Delay: 100}}, chReport, l)
 
 	scanErrors := make(map[string]string)
 
@@ -50,7 +99,7 @@ func TestService_parse(t *testing.T) {
 			}
 		}
 	}()
-	s.Scan(urls, -1, "", []string{host + "/test/not_existing.png"})
+	s.Scan(conf.ScheduleData{URL: urls, Depth: -1, ExcludedURL: []string{host + "/test/not_existing.png"}})
 
 	close(s.ChResults)
 
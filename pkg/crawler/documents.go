@@ -0,0 +1,432 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Типы документов, в которых ищутся ссылки
+const (
+	docHTML     = "html"
+	docCSS      = "css"
+	docMarkdown = "markdown"
+	docText     = "text"
+	docPDF      = "pdf"
+)
+
+// Максимальный размер документа Markdown, текста или PDF, в котором ищутся ссылки
+const maxDocumentSize = 20 * 1024 * 1024
+
+// Расширения файлов Markdown
+var markdownExts = map[string]bool{".md": true, ".markdown": true, ".mdown": true, ".mkd": true}
+
+var (
+	// Ссылка или изображение: [text](url "title"), ![alt](url). URL может содержать парные скобки
+	mdInlineRe = regexp.MustCompile(`(!?)\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\(\s*(?:<([^<>\n]*)>|((?:[^\s()]|\([^\s()]*\))+))(?:\s+(?:"[^"]*"|'[^']*'|\([^)]*\)))?\s*\)`)
+	// Определение ссылки: [id]: url "title"
+	mdReferenceRe = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*(?:<([^<>]*)>|(\S+))`)
+	// Автоссылка: <https://example.com>
+	mdAutolinkRe = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	// Начало и конец блока кода: ``` или ~~~
+	mdFenceRe = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	// Код в строке: `code`
+	mdCodeRe = regexp.MustCompile("`+[^`]*`+")
+	// URL в тексте
+	textURLRe = regexp.MustCompile("(?i)\\bhttps?://[^\\s<>\"'`]+")
+)
+
+// documentType возвращает тип документа по заголовку Content-Type ответа, а если по нему тип не ясен
+// (text/plain, application/octet-stream) - по расширению файла ссылки. Пустой тип - ссылки в документе не ищутся
+func documentType(contentType, link string) string {
+	ct := strings.ToLower(contentType)
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = ct[:i]
+	}
+	ct = strings.TrimSpace(ct)
+	switch {
+	case strings.Contains(ct, "text/html"):
+		return docHTML
+	case ct == "text/css":
+		return docCSS
+	case ct == "text/markdown", ct == "text/x-markdown":
+		return docMarkdown
+	case ct == "application/pdf":
+		return docPDF
+	case ct != "text/plain" && ct != "application/octet-stream" && ct != "":
+		return ""
+	}
+	e := ext(linkPath(link))
+	switch {
+	case markdownExts[e]:
+		return docMarkdown
+	case e == ".pdf" && ct != "text/plain":
+		return docPDF
+	case e == ".txt" || ct == "text/plain":
+		return docText
+	}
+	return ""
+}
+
+// documentLinks возвращает ссылки из документа Markdown, текста или PDF
+func documentLinks(docType string, r io.Reader) []Link {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxDocumentSize))
+	if err != nil {
+		return nil
+	}
+	switch docType {
+	case docMarkdown:
+		return markdownLinks(string(data))
+	case docText:
+		return textLinks(string(data))
+	case docPDF:
+		return pdfLinks(data)
+	}
+	return nil
+}
+
+// markdownLinks возвращает ссылки документа Markdown: встроенные ссылки и изображения, определения ссылок,
+// автоссылки и URL в тексте. Блоки и фрагменты кода пропускаются
+func markdownLinks(text string) []Link {
+	l := links{list: make([]Link, 0)}
+	var fence string
+	for n, line := range strings.Split(text, "\n") {
+		if m := mdFenceRe.FindStringSubmatch(line); m != nil {
+			switch {
+			case fence == "":
+				fence = m[1]
+			case m[1][0] == fence[0] && len(m[1]) >= len(fence):
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		// Найденное заменяется пробелами, чтобы не искать в нем URL повторно
+		line = mdCodeRe.ReplaceAllStringFunc(line, blank)
+		if m := mdReferenceRe.FindStringSubmatch(line); m != nil {
+			l.add(Link{URL: m[1] + m[2], Tag: docMarkdown, Attr: "reference", Line: n + 1})
+			continue
+		}
+		for _, m := range mdInlineRe.FindAllStringSubmatch(line, -1) {
+			attr := "link"
+			if m[1] == "!" {
+				attr = "image"
+			}
+			l.add(Link{URL: m[3] + m[4], Tag: docMarkdown, Attr: attr, Text: strings.TrimSpace(m[2]), Line: n + 1})
+		}
+		line = mdInlineRe.ReplaceAllStringFunc(line, blank)
+		for _, m := range mdAutolinkRe.FindAllStringSubmatch(line, -1) {
+			l.add(Link{URL: m[1], Tag: docMarkdown, Attr: "autolink", Line: n + 1})
+		}
+		line = mdAutolinkRe.ReplaceAllStringFunc(line, blank)
+		for _, u := range lineURLs(line) {
+			l.add(Link{URL: u, Tag: docMarkdown, Attr: "url", Line: n + 1})
+		}
+	}
+	return l.list
+}
+
+// textLinks возвращает URL, найденные в тексте
+func textLinks(text string) []Link {
+	l := links{list: make([]Link, 0)}
+	for n, line := range strings.Split(text, "\n") {
+		for _, u := range lineURLs(line) {
+			l.add(Link{URL: u, Tag: docText, Attr: "url", Line: n + 1})
+		}
+	}
+	return l.list
+}
+
+// blank возвращает строку из пробелов той же длины
+func blank(s string) string {
+	return strings.Repeat(" ", len(s))
+}
+
+// lineURLs возвращает URL в строке текста без завершающих знаков препинания и непарных закрывающих скобок
+func lineURLs(line string) []string {
+	urls := textURLRe.FindAllString(line, -1)
+	for i, u := range urls {
+		for {
+			trimmed := strings.TrimRight(u, ".,:;!?*_~")
+			last := trimmed[len(trimmed)-1]
+			if (last == ')' && strings.Count(trimmed, "(") < strings.Count(trimmed, ")")) ||
+				(last == ']' && strings.Count(trimmed, "[") < strings.Count(trimmed, "]")) {
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+			if trimmed == u {
+				break
+			}
+			u = trimmed
+		}
+		urls[i] = u
+	}
+	return urls
+}
+
+var (
+	// Заголовок объекта PDF: "12 0 obj"
+	pdfObjRe = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	// Начало потока после словаря объекта
+	pdfStreamRe = regexp.MustCompile(`>>\s*stream(?:\r\n|\r|\n)`)
+	// Ссылка на объект: "12 0 R"
+	pdfRefRe    = regexp.MustCompile(`(\d+)\s+\d+\s+R\b`)
+	pdfPagesRe  = regexp.MustCompile(`/Pages\s*(\d+)\s+\d+\s+R`)
+	pdfKidsRe   = regexp.MustCompile(`/Kids\s*\[([^\]]*)\]`)
+	pdfAnnotsRe = regexp.MustCompile(`/Annots\s*(?:\[([^\]]*)\]|(\d+)\s+\d+\s+R)`)
+	pdfActionRe = regexp.MustCompile(`/A\s*(\d+)\s+\d+\s+R`)
+	pdfURIRe    = regexp.MustCompile(`/URI\s*([(<])`)
+	pdfIntRe    = regexp.MustCompile(`/(N|First)\s+(\d+)`)
+)
+
+// pdfLinks возвращает ссылки из аннотаций страниц документа PDF с номерами страниц.
+// Если дерево страниц не найдено, возвращаются все ссылки документа без номеров страниц.
+// В зашифрованных документах ссылки не ищутся
+func pdfLinks(data []byte) []Link {
+	l := links{list: make([]Link, 0)}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return l.list
+	}
+	objects := pdfObjects(data)
+	var catalog string
+	for _, obj := range objects {
+		if strings.Contains(obj, "/Catalog") {
+			catalog = obj
+			break
+		}
+	}
+	var pages []string
+	if m := pdfPagesRe.FindStringSubmatch(catalog); m != nil {
+		pages = pdfPageTree(objects, m[1], make(map[string]bool))
+	}
+	if len(pages) == 0 {
+		nums := make([]int, 0, len(objects))
+		for num := range objects {
+			n, _ := strconv.Atoi(num)
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		for _, n := range nums {
+			for _, u := range pdfURIs(objects[strconv.Itoa(n)]) {
+				l.add(Link{URL: u, Tag: docPDF, Attr: "uri"})
+			}
+		}
+		return l.list
+	}
+	for i, page := range pages {
+		m := pdfAnnotsRe.FindStringSubmatch(page)
+		if m == nil {
+			continue
+		}
+		annots := m[1]
+		if m[2] != "" {
+			annots = objects[m[2]]
+		}
+		// Аннотации указываются ссылками на объекты или словарями прямо в массиве
+		texts := []string{annots}
+		for _, ref := range pdfRefRe.FindAllStringSubmatch(annots, -1) {
+			texts = append(texts, objects[ref[1]])
+		}
+		for _, text := range texts {
+			// Действие аннотации может быть отдельным объектом
+			for _, ref := range pdfActionRe.FindAllStringSubmatch(text, -1) {
+				texts = append(texts, objects[ref[1]])
+			}
+		}
+		for _, text := range texts {
+			for _, u := range pdfURIs(text) {
+				l.add(Link{URL: u, Tag: docPDF, Attr: "uri", Page: i + 1})
+			}
+		}
+	}
+	return l.list
+}
+
+// pdfObjects возвращает словари объектов документа PDF по номерам объектов, включая объекты из потоков объектов.
+// Содержимое остальных потоков не возвращается
+func pdfObjects(data []byte) map[string]string {
+	objects := make(map[string]string)
+	for pos := 0; pos < len(data); {
+		loc := pdfObjRe.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num := string(data[pos+loc[2] : pos+loc[3]])
+		start := pos + loc[1]
+		end := bytes.Index(data[start:], []byte("endobj"))
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += start
+		}
+		pos = end
+		if s := pdfStreamRe.FindIndex(data[start:end]); s != nil {
+			dict := string(data[start : start+s[0]+2])
+			objects[num] = dict
+			stream := data[start+s[1]:]
+			// endobj мог встретиться внутри сжатых данных потока
+			if e := bytes.Index(stream, []byte("endstream")); e >= 0 {
+				stream = stream[:e]
+				if next := bytes.Index(data[start+s[1]+e:], []byte("endobj")); next >= 0 {
+					pos = start + s[1] + e + next
+				}
+			}
+			if strings.Contains(dict, "/ObjStm") {
+				pdfObjectStream(objects, dict, stream)
+			}
+			continue
+		}
+		objects[num] = string(data[start:end])
+	}
+	return objects
+}
+
+// pdfObjectStream добавляет объекты из потока объектов, сжатого FlateDecode без предиктора
+func pdfObjectStream(objects map[string]string, dict string, stream []byte) {
+	if !strings.Contains(dict, "/FlateDecode") || strings.Contains(dict, "/DecodeParms") {
+		return
+	}
+	var n, first int
+	for _, m := range pdfIntRe.FindAllStringSubmatch(dict, -1) {
+		v, _ := strconv.Atoi(m[2])
+		if m[1] == "N" {
+			n = v
+		} else {
+			first = v
+		}
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return
+	}
+	defer zr.Close()
+	// Поток может быть поврежден в конце: используется то, что удалось распаковать
+	content, _ := ioutil.ReadAll(io.LimitReader(zr, maxDocumentSize))
+	if first > len(content) {
+		return
+	}
+	header := strings.Fields(string(content[:first]))
+	if len(header) < 2*n {
+		return
+	}
+	for i := 0; i < n; i++ {
+		from, err1 := strconv.Atoi(header[2*i+1])
+		to := len(content) - first
+		if i+1 < n {
+			to, _ = strconv.Atoi(header[2*i+3])
+		}
+		if err1 != nil || from < 0 || from > to || first+to > len(content) {
+			return
+		}
+		objects[header[2*i]] = string(content[first+from : first+to])
+	}
+}
+
+// pdfPageTree возвращает словари страниц дерева страниц с корнем num в порядке следования страниц
+func pdfPageTree(objects map[string]string, num string, visited map[string]bool) []string {
+	if visited[num] {
+		return nil
+	}
+	visited[num] = true
+	node := objects[num]
+	m := pdfKidsRe.FindStringSubmatch(node)
+	if m == nil {
+		if strings.Contains(node, "/Page") {
+			return []string{node}
+		}
+		return nil
+	}
+	var pages []string
+	for _, ref := range pdfRefRe.FindAllStringSubmatch(m[1], -1) {
+		pages = append(pages, pdfPageTree(objects, ref[1], visited)...)
+	}
+	return pages
+}
+
+// pdfURIs возвращает значения ключей /URI словаря
+func pdfURIs(dict string) []string {
+	var uris []string
+	for _, loc := range pdfURIRe.FindAllStringSubmatchIndex(dict, -1) {
+		if u, ok := pdfString(dict[loc[2]:]); ok {
+			uris = append(uris, u)
+		}
+	}
+	return uris
+}
+
+// pdfString разбирает строку PDF в начале s: литерал (text) со скобками и экранированием или шестнадцатеричную строку <68656c6c6f>
+func pdfString(s string) (string, bool) {
+	if strings.HasPrefix(s, "<") {
+		end := strings.Index(s, ">")
+		if end < 0 {
+			return "", false
+		}
+		hex := strings.Join(strings.Fields(s[1:end]), "")
+		if len(hex)%2 == 1 {
+			hex += "0"
+		}
+		var b strings.Builder
+		for i := 0; i+1 < len(hex); i += 2 {
+			v, err := strconv.ParseUint(hex[i:i+2], 16, 8)
+			if err != nil {
+				return "", false
+			}
+			b.WriteByte(byte(v))
+		}
+		return b.String(), true
+	}
+	var b strings.Builder
+	depth := 0
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return b.String(), true
+			}
+			depth--
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", false
+			}
+			switch c = s[i]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// Перенос строки внутри литерала
+				if c == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+					i++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for k := 0; k < 2 && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '7'; k++ {
+						i++
+						v = v*8 + int(s[i]-'0')
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b.WriteByte(c)
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_documents(t *testing.T) {
+	var ts *httptest.Server
+	// PDF из двух страниц: аннотация первой страницы лежит в сжатом потоке объектов, второй - в обычном объекте
+	pdf := func() []byte {
+		var stream bytes.Buffer
+		zw := zlib.NewWriter(&stream)
+		annot := "<< /Type /Annot /Subtype /Link /A << /S /URI /URI (" + ts.URL + "/pdf\\(1\\)) >> >>"
+		fmt.Fprintf(zw, "6 0 %s", annot)
+		zw.Close()
+		var b bytes.Buffer
+		b.WriteString("%PDF-1.5\n")
+		b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+		b.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>\nendobj\n")
+		b.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Annots [6 0 R] >>\nendobj\n")
+		b.WriteString("4 0 obj\n<< /Type /Page /Parent 2 0 R /Annots [5 0 R] >>\nendobj\n")
+		b.WriteString("5 0 obj\n<< /Type /Annot /Subtype /Link /A 8 0 R >>\nendobj\n")
+		fmt.Fprintf(&b, "7 0 obj\n<< /Type /ObjStm /N 1 /First 4 /Filter /FlateDecode /Length %d >>\nstream\n", stream.Len())
+		b.Write(stream.Bytes())
+		b.WriteString("\nendstream\nendobj\n")
+		b.WriteString("8 0 obj\n<< /S /URI /URI <" + fmt.Sprintf("%x", ts.URL+"/missing-pdf") + "> >>\nendobj\n")
+		b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+		return b.Bytes()
+	}
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/docs/readme.md">readme</a> <a href="/notes.txt">notes</a> <a href="/manual.pdf">manual</a>`)
+		case "/docs/readme.md":
+			// Тип документа определяется по расширению
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, "# Readme\n\n"+
+				"See [the guide](guide.md \"Guide\") and ![logo](/img/missing.png).\n"+
+				"[ref]: /missing-ref\n"+
+				"Autolink <"+ts.URL+"/missing-auto> and "+ts.URL+"/ok.\n"+
+				"```\n"+
+				"[not a link](/in-code)\n"+
+				"```\n"+
+				"Inline `"+ts.URL+"/in-code` code.\n")
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, "Notes\n(see "+ts.URL+"/missing-text).\n")
+		case "/manual.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(pdf())
+		case "/docs/guide.md", "/ok", "/pdf(1)":
+			w.Header().Set("Content-Type", "text/markdown")
+			fmt.Fprint(w, "ok")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	s := runScan(t, nil, nil, conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: -1})
+
+	got := make([]string, 0, len(s.Errors))
+	for link, e := range s.Errors {
+		got = append(got, fmt.Sprintf("%s %s line %d page %d %s", strings.TrimPrefix(link, ts.URL), strings.TrimPrefix(e.ParentURL, ts.URL), e.Line, e.Page, e.Kind))
+	}
+	sort.Strings(got)
+	want := []string{
+		"/img/missing.png /docs/readme.md line 3 page 0 image",
+		"/missing-auto /docs/readme.md line 5 page 0 link",
+		"/missing-pdf /manual.pdf line 0 page 2 link",
+		"/missing-ref /docs/readme.md line 4 page 0 link",
+		"/missing-text /notes.txt line 2 page 0 link",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Errors:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+	for _, link := range []string{"/docs/guide.md", "/ok", "/pdf(1)"} {
+		if !s.Processed[ts.URL+link] {
+			t.Errorf("Link %s is not checked", link)
+		}
+	}
+	if s.Processed[ts.URL+"/in-code"] {
+		t.Error("Link in code is checked")
+	}
+}
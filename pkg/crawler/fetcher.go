@@ -0,0 +1,401 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"blc/pkg/conf"
+)
+
+// Fetcher выполняет HTTP-запросы сканирования. Клиент сканирования передает ему каждый запрос
+// цепочки перенаправлений отдельно и сам обрабатывает перенаправления, cookie и таймауты
+type Fetcher interface {
+	http.RoundTripper
+	// Close вызывается по окончании сканирования
+	Close() error
+}
+
+// Версия формата HAR
+const harVersion = "1.2"
+
+// Заголовки запроса и ответа, значения которых не записываются в архив
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// harArchive это архив запросов в формате HAR 1.2
+type harArchive struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// harEntry это запрос и ответ на него. Ошибка запроса записывается в поле _error
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+	// URL пробы soft 404, если запрос - проба
+	Probe string `json:"_probe,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	Cookies     []harNameValue `json:"cookies"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Cookies     []harNameValue `json:"cookies"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harHeaders переводит заголовки в формат HAR
+func harHeaders(h http.Header) []harNameValue {
+	headers := make([]harNameValue, 0, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, harNameValue{Name: name, Value: v})
+		}
+	}
+	return headers
+}
+
+// CheckFetcher проверяет настройки записи и воспроизведения сканирования
+func CheckFetcher(sched conf.ScheduleData) error {
+	if sched.Record != "" && sched.Replay != "" {
+		return fmt.Errorf("a scan cannot be recorded and replayed at the same time")
+	}
+	if sched.Dir != "" {
+		if sched.Replay != "" {
+			return fmt.Errorf("a directory scan cannot be replayed")
+		}
+		if _, err := checkDir(sched.Dir, sched.URL); err != nil {
+			return err
+		}
+	}
+	if sched.Replay != "" {
+		if _, err := NewReplayFetcher(sched.Replay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveFetcher выполняет запросы по сети
+type liveFetcher struct {
+	*http.Transport
+}
+
+// Close закрывает неактивные соединения
+func (f liveFetcher) Close() error {
+	f.CloseIdleConnections()
+	return nil
+}
+
+// recordFetcher записывает запросы и ответы другого исполнителя в архив HAR
+type recordFetcher struct {
+	next    Fetcher
+	path    string
+	redact  []string
+	mux     sync.Mutex
+	entries []harEntry
+}
+
+// NewRecordFetcher возвращает исполнитель, который выполняет запросы через next и по окончании сканирования
+// записывает их в архив HAR path. Значения заголовков авторизации и cookie, а также заголовков headers
+// в архив не попадают
+func NewRecordFetcher(next Fetcher, path string, headers ...string) Fetcher {
+	redact := append(append([]string{}, redactedHeaders...), headers...)
+	return &recordFetcher{next: next, path: path, redact: redact}
+}
+
+// recordBody запоминает ту часть тела ответа, которую прочитал клиент, и при закрытии тела
+// добавляет ответ в архив. Тело читается так же, как без записи: с теми же ограничениями размера
+type recordBody struct {
+	io.ReadCloser
+	fetcher *recordFetcher
+	entry   harEntry
+	data    bytes.Buffer
+	once    sync.Once
+}
+
+// Read читает тело ответа и запоминает прочитанное
+func (b *recordBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.data.Write(p[:n])
+	return n, err
+}
+
+// Close закрывает тело ответа и добавляет ответ в архив
+func (b *recordBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		body := b.data.Bytes()
+		b.entry.Response.BodySize = len(body)
+		b.entry.Response.Content.Size = len(body)
+		if utf8.Valid(body) {
+			b.entry.Response.Content.Text = string(body)
+		} else {
+			b.entry.Response.Content.Text, b.entry.Response.Content.Encoding = base64.StdEncoding.EncodeToString(body), "base64"
+		}
+		b.fetcher.add(b.entry)
+	})
+	return err
+}
+
+// redactHeaders заменяет значения секретных заголовков
+func (f *recordFetcher) redactHeaders(headers []harNameValue) {
+	for i, h := range headers {
+		for _, name := range f.redact {
+			if strings.EqualFold(h.Name, name) {
+				headers[i].Value = "[redacted]"
+			}
+		}
+	}
+}
+
+// add добавляет запись в архив
+func (f *recordFetcher) add(e harEntry) {
+	f.mux.Lock()
+	f.entries = append(f.entries, e)
+	f.mux.Unlock()
+}
+
+// RoundTrip выполняет запрос. Ответ попадает в архив, когда клиент закрывает его тело
+func (f *recordFetcher) RoundTrip(request *http.Request) (*http.Response, error) {
+	e := harEntry{StartedDateTime: time.Now()}
+	// Пробу отмечаем только у первого запроса цепочки перенаправлений
+	if link, ok := request.Context().Value(probeKey{}).(string); ok && request.Response == nil {
+		e.Probe = link
+	}
+	e.Request = harRequest{
+		Method:      request.Method,
+		URL:         request.URL.String(),
+		HTTPVersion: "HTTP/1.1",
+		Headers:     harHeaders(request.Header),
+		QueryString: []harNameValue{},
+		Cookies:     []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	f.redactHeaders(e.Request.Headers)
+	for name, values := range request.URL.Query() {
+		for _, v := range values {
+			e.Request.QueryString = append(e.Request.QueryString, harNameValue{Name: name, Value: v})
+		}
+	}
+	e.Response = harResponse{Headers: []harNameValue{}, Cookies: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+
+	response, err := f.next.RoundTrip(request)
+	e.Time = float64(time.Since(e.StartedDateTime)) / float64(time.Millisecond)
+	e.Timings.Wait = e.Time
+	if err != nil {
+		e.Error = err.Error()
+		f.add(e)
+		return nil, err
+	}
+	e.Response.Status = response.StatusCode
+	e.Response.StatusText = strings.TrimSpace(strings.TrimPrefix(response.Status, strconv.Itoa(response.StatusCode)))
+	e.Response.HTTPVersion = response.Proto
+	e.Response.Headers = harHeaders(response.Header)
+	f.redactHeaders(e.Response.Headers)
+	e.Response.RedirectURL = response.Header.Get("Location")
+	e.Response.Content = harContent{MimeType: response.Header.Get("Content-Type")}
+	response.Body = &recordBody{ReadCloser: response.Body, fetcher: f, entry: e}
+	return response, nil
+}
+
+// Close записывает архив
+func (f *recordFetcher) Close() error {
+	err := f.next.Close()
+	f.mux.Lock()
+	har := harArchive{Log: harLog{Version: harVersion, Creator: harCreator{Name: "blc", Version: harVersion}, Entries: f.entries}}
+	if har.Log.Entries == nil {
+		har.Log.Entries = []harEntry{}
+	}
+	data, jerr := json.MarshalIndent(har, "", "  ")
+	f.mux.Unlock()
+	if jerr != nil {
+		return jerr
+	}
+	if werr := writeFileAtomic(f.path, data); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// replayFetcher отвечает на запросы из архива HAR, не обращаясь к сети
+type replayFetcher struct {
+	mux sync.Mutex
+	// Записи по ключу запроса и количество уже выданных ответов на такой запрос
+	entries map[string][]harEntry
+	served  map[string]int
+	// Записанные URL проб soft 404 по схеме и хосту
+	probes map[string]string
+}
+
+// replayKey возвращает ключ запроса: метод, URL и запрошенный диапазон
+func replayKey(method, link, rng string) string {
+	return method + " " + link + " " + rng
+}
+
+// NewReplayFetcher возвращает исполнитель, который отвечает на запросы из архива HAR path.
+// Повторные запросы получают записанные ответы по порядку, после последнего ответа повторяется он же.
+// Запросы, которых нет в архиве, завершаются ошибкой
+func NewReplayFetcher(path string) (Fetcher, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var har harArchive
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("archive %s: %v", path, err)
+	}
+	f := replayFetcher{entries: make(map[string][]harEntry), served: make(map[string]int), probes: make(map[string]string)}
+	for _, e := range har.Log.Entries {
+		if e.Probe != "" {
+			if u, err := url.Parse(e.Probe); err == nil {
+				f.probes[u.Scheme+"://"+strings.ToLower(u.Host)] = e.Probe
+			}
+		}
+		var rng string
+		for _, h := range e.Request.Headers {
+			if strings.EqualFold(h.Name, "Range") {
+				rng = h.Value
+			}
+		}
+		key := replayKey(e.Request.Method, e.Request.URL, rng)
+		f.entries[key] = append(f.entries[key], e)
+	}
+	return &f, nil
+}
+
+// RoundTrip возвращает записанный ответ на запрос
+func (f *replayFetcher) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	key := replayKey(request.Method, request.URL.String(), request.Header.Get("Range"))
+	f.mux.Lock()
+	entries := f.entries[key]
+	n := f.served[key]
+	if n < len(entries)-1 {
+		f.served[key]++
+	}
+	f.mux.Unlock()
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s %s is not in the archive", request.Method, request.URL)
+	}
+	e := entries[n]
+	if e.Error != "" {
+		return nil, fmt.Errorf("%s", e.Error)
+	}
+	body := []byte(e.Response.Content.Text)
+	if e.Response.Content.Encoding == "base64" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+			return nil, fmt.Errorf("%s %s: %v", request.Method, request.URL, err)
+		}
+	}
+	response := http.Response{
+		Status:        strings.TrimSpace(strconv.Itoa(e.Response.Status) + " " + e.Response.StatusText),
+		StatusCode:    e.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+	for _, h := range e.Response.Headers {
+		response.Header.Add(h.Name, h.Value)
+	}
+	return &response, nil
+}
+
+// Close ничего не делает: архив только читается
+func (f *replayFetcher) Close() error {
+	return nil
+}
+
+// setupFetcher включает сканирование каталога, запись сканирования в архив или воспроизведение из архива.
+// Если каталог или архив недоступен, возвращает ошибку: сканировать вместо них сеть нельзя
+func (s *Service) setupFetcher(sched conf.ScheduleData) error {
+	if sched.Dir != "" {
+		base, err := checkDir(sched.Dir, sched.URL)
+		if err != nil {
+			return fmt.Errorf("directory %s: %v", sched.Dir, err)
+		}
+		s.SetFetcher(NewFileFetcher(sched.Dir, base, s.fetcher))
+	}
+	switch {
+	case sched.Replay != "":
+		f, err := NewReplayFetcher(sched.Replay)
+		if err != nil {
+			return fmt.Errorf("replay %s: %v", sched.Replay, err)
+		}
+		s.SetFetcher(f)
+	case sched.Record != "":
+		s.SetFetcher(NewRecordFetcher(s.fetcher, sched.Record, authHeaders(s.credentials)...))
+	}
+	return nil
+}
+
+// SetFetcher заменяет исполнитель запросов. Вызывать до начала сканирования
+func (s *Service) SetFetcher(f Fetcher) {
+	s.fetcher = f
+}
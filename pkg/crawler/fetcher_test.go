@@ -0,0 +1,136 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"blc/pkg/conf"
+)
+
+func TestService_recordReplay(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "cookie-secret"})
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/moved">moved</a> <a href="/missing">missing</a> <a href="/logo">logo</a> <a href="/manual.pdf">manual</a>`)
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/missing#top">missing</a>`)
+		case "/logo":
+			// Тело картинки сканер не читает, и в архив оно не попадает
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G', 0xff, 0x00})
+			w.Write(make([]byte, 1<<20))
+		case "/manual.pdf":
+			// Документ PDF читается целиком, в архив попадает двоичное тело
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n%%EOF\n"))
+		default:
+			if _, err := uuid.Parse(strings.TrimPrefix(r.URL.Path, "/")); err == nil {
+				// Проба soft 404 получает страницу "не найдено" с кодом 200
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprint(w, `<title>Not found</title>`)
+				return
+			}
+			http.NotFound(w, r)
+		}
+	}))
+	archive := filepath.Join(t.TempDir(), "scan.har")
+	os.Setenv("BLC_TEST_API_KEY", "key-secret")
+	defer os.Unsetenv("BLC_TEST_API_KEY")
+	cfg := &conf.Config{Credentials: map[string]*conf.Credentials{
+		"api": {Type: AuthHeader, Header: []string{"X-Api-Key: ${env:BLC_TEST_API_KEY}"}},
+	}}
+
+	scan := func(sched conf.ScheduleData) (*testScan, []string) {
+		sched.Depth = 3
+		sched.Credentials = []string{"api"}
+		sched.Soft404 = true
+		s := runScan(t, cfg, nil, sched)
+		var results []string
+		for _, r := range s.Results {
+			if r.URL != "" {
+				results = append(results, fmt.Sprintf("%s %d %s", r.URL, r.HTTPStatus, r.Error))
+			}
+		}
+		sort.Strings(results)
+		return s, results
+	}
+
+	recorded, want := scan(conf.ScheduleData{URL: []string{ts.URL + "/"}, Record: archive})
+	ts.Close()
+	if len(recorded.Errors) != 1 {
+		t.Fatalf("Recorded errors: %v", recorded.Errors)
+	}
+	if err := CheckFetcher(conf.ScheduleData{Replay: archive}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"version": "1.2"`) || !strings.Contains(string(data), `"encoding": "base64"`) {
+		t.Errorf("Archive is not a HAR file with binary content: %.200s", data)
+	}
+	if strings.Contains(string(data), "cookie-secret") || strings.Contains(string(data), "key-secret") {
+		t.Error("Secrets are written to the archive")
+	}
+	if len(data) > 1<<19 {
+		t.Errorf("Archive contains bodies the crawler did not read: %d bytes", len(data))
+	}
+
+	replayed, got := scan(conf.ScheduleData{URL: []string{ts.URL + "/"}, Replay: archive})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Replayed results:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+	if !reflect.DeepEqual(replayed.Errors, recorded.Errors) {
+		t.Errorf("Replayed errors:\r\nполучено: %v\r\nожидается: %v", replayed.Errors, recorded.Errors)
+	}
+	// Проба soft 404 воспроизводится по записанному случайному URL
+	if p := replayed.soft404.probes[ts.URL]; p == nil || p.page == nil {
+		t.Error("Soft 404 probe is not replayed")
+	}
+
+	// Запросы, которых нет в архиве, не выполняются
+	missing, _ := scan(conf.ScheduleData{URL: []string{ts.URL + "/other"}, Replay: archive})
+	if e, ok := missing.Errors[ts.URL+"/other"]; !ok || !strings.Contains(e.Error, "not in the archive") {
+		t.Errorf("Request missing in the archive: %v", missing.Errors)
+	}
+	if err := CheckFetcher(conf.ScheduleData{Record: archive, Replay: archive}); err == nil {
+		t.Error("Record and replay at the same time are accepted")
+	}
+}
+
+func TestService_replayMissingArchive(t *testing.T) {
+	var requests int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	})
+	archive := filepath.Join(t.TempDir(), "missing.har")
+	s := runScan(t, nil, handler, conf.ScheduleData{URL: []string{"/"}, Depth: -1, Replay: archive})
+
+	// Без архива сканирование не должно идти по сети
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("Запросов к серверу: %d, ожидается 0", n)
+	}
+	if !strings.Contains(s.StopReason, archive) {
+		t.Errorf("StopReason: %q", s.StopReason)
+	}
+	if len(s.Processed) != 0 {
+		t.Errorf("Processed: %v", s.Processed)
+	}
+}
@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Страница, которая отдается вместо отсутствующих файлов, если она есть в каталоге
+const notFoundPage = "404.html"
+
+// fileFetcher отвечает на запросы ссылок базового URL файлами каталога, как статический веб-сервер,
+// остальные запросы передает исполнителю next
+type fileFetcher struct {
+	root string
+	base *url.URL
+	next Fetcher
+}
+
+// NewFileFetcher возвращает исполнитель, который отвечает на запросы ссылок, начинающихся с base, файлами каталога root.
+// Для пути каталога отдается его index.html, для пути без расширения - файл с расширением .html (pretty URL),
+// для отсутствующих файлов - 404.html каталога с кодом 404. Путь каталога без косой черты в конце
+// перенаправляется на путь с ней, как это делают статические веб-серверы
+func NewFileFetcher(root string, base *url.URL, next Fetcher) Fetcher {
+	b := *base
+	if !strings.HasSuffix(b.Path, "/") {
+		b.Path += "/"
+	}
+	return &fileFetcher{root: root, base: &b, next: next}
+}
+
+// RoundTrip отвечает на запрос файлом или передает его дальше
+func (f *fileFetcher) RoundTrip(request *http.Request) (*http.Response, error) {
+	u := request.URL
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	// Базовый URL без завершающей косой черты тоже ведет в корень каталога
+	if !strings.EqualFold(u.Scheme, f.base.Scheme) || !strings.EqualFold(u.Host, f.base.Host) ||
+		!strings.HasPrefix(p+"/", f.base.Path) {
+		return f.next.RoundTrip(request)
+	}
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	rel := strings.TrimPrefix(p, strings.TrimSuffix(f.base.Path, "/"))
+	// Clean не дает выйти за пределы каталога через ".."
+	name := filepath.Join(f.root, filepath.FromSlash(path.Clean("/"+rel)))
+
+	status := http.StatusOK
+	file, ok := f.lookup(name)
+	if ok && !strings.HasSuffix(p, "/") && filepath.Base(file) == "index.html" && filepath.Base(name) != "index.html" {
+		return f.redirect(request, path.Base(p)+"/"), nil
+	}
+	if !ok {
+		status = http.StatusNotFound
+		file, ok = f.lookup(filepath.Join(f.root, notFoundPage))
+	}
+	var body []byte
+	if ok {
+		var err error
+		if body, err = ioutil.ReadFile(file); err != nil {
+			return nil, err
+		}
+	} else {
+		body = []byte("404 page not found\n")
+		file = ".txt"
+	}
+
+	response := http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    request,
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(file))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	response.Header.Set("Content-Type", contentType)
+	response.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	response.ContentLength = int64(len(body))
+	if request.Method == http.MethodHead {
+		body = nil
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return &response, nil
+}
+
+// redirect возвращает постоянное перенаправление по ссылке location
+func (f *fileFetcher) redirect(request *http.Request, location string) *http.Response {
+	if request.URL.RawQuery != "" {
+		location += "?" + request.URL.RawQuery
+	}
+	response := http.Response{
+		Status:     strconv.Itoa(http.StatusMovedPermanently) + " " + http.StatusText(http.StatusMovedPermanently),
+		StatusCode: http.StatusMovedPermanently,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Location": {location}},
+		Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		Request:    request,
+	}
+	return &response
+}
+
+// lookup ищет файл для пути name: сам файл, index.html каталога или файл с расширением .html
+func (f *fileFetcher) lookup(name string) (string, bool) {
+	candidates := []string{name, filepath.Join(name, "index.html")}
+	if filepath.Ext(name) == "" {
+		candidates = append(candidates, name+".html")
+	}
+	for _, c := range candidates {
+		if fi, err := os.Stat(c); err == nil && fi.Mode().IsRegular() {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// Close закрывает исполнитель внешних запросов
+func (f *fileFetcher) Close() error {
+	return f.next.Close()
+}
+
+// dirBase возвращает базовый URL ссылок страницы link. При сканировании каталога файлы статического сайта
+// ссылаются друг на друга относительно собственного адреса (после перенаправления - конечного), а не адреса base
+// страницы, с которой на них перешли
+func (s *Service) dirBase(base, link *url.URL, response *http.Response, redirected bool) *url.URL {
+	if s.sched.Dir == "" {
+		return base
+	}
+	if redirected {
+		return response.Request.URL
+	}
+	return link
+}
+
+// checkDir проверяет каталог сканирования и базовый URL
+func checkDir(dir string, urls []string) (*url.URL, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("base URL of directory %s is not set", dir)
+	}
+	base, err := url.Parse(urls[0])
+	if err != nil {
+		return nil, err
+	}
+	if !base.IsAbs() || base.Host == "" {
+		return nil, fmt.Errorf("base URL %s is not absolute", urls[0])
+	}
+	return base, nil
+}
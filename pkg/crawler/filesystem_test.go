@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_dir(t *testing.T) {
+	var external []string
+	var mux sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		external = append(external, r.URL.Path)
+		mux.Unlock()
+		if r.URL.Path != "/ok" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":      `<a href="about">about</a> <a href="docs">docs</a> <a href="missing">missing</a> <a href="` + ts.URL + `/ok">ok</a>`,
+		"about.html":      `<a href="./">home</a> <a href="/site/img/logo.png">logo</a> <a href="` + ts.URL + `/gone">gone</a>`,
+		"docs/index.html": `<a href="../about">about</a> <a href="page.html">page</a>`,
+		"img/logo.png":    "\x89PNG",
+		"404.html":        `<h1>Not found</h1> <a href="/site/">home</a>`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := "https://example.invalid/site"
+	sched := conf.ScheduleData{URL: []string{base}, Depth: -1, Dir: dir}
+	if err := CheckFetcher(sched); err != nil {
+		t.Fatal(err)
+	}
+	s := runScan(t, nil, nil, sched)
+
+	var broken []string
+	for link, e := range s.Errors {
+		broken = append(broken, fmt.Sprintf("%s %d", link, e.HTTPStatus))
+	}
+	sort.Strings(broken)
+	want := []string{
+		"https://example.invalid/site/docs/page.html 404",
+		"https://example.invalid/site/missing 404",
+		ts.URL + "/gone 404",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(broken, want) {
+		t.Errorf("Broken links:\r\nполучено: %v\r\nожидается: %v", broken, want)
+	}
+	sort.Strings(external)
+	if !reflect.DeepEqual(external, []string{"/gone", "/ok"}) {
+		t.Errorf("Only external links are fetched over HTTP, got %v", external)
+	}
+
+	if err := CheckFetcher(conf.ScheduleData{URL: []string{base}, Dir: filepath.Join(dir, "index.html")}); err == nil {
+		t.Error("A file is accepted as the scan directory")
+	}
+	if err := CheckFetcher(conf.ScheduleData{URL: []string{"/site"}, Dir: dir}); err == nil {
+		t.Error("A relative base URL is accepted")
+	}
+}
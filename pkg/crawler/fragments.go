@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// pageAnchors возвращает идентификаторы элементов и имена якорей <a name> HTML-документа
+func pageAnchors(n *html.Node) map[string]bool {
+	anchors := make(map[string]bool)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id, ok := attrValue(n, "id"); ok && id != "" {
+				anchors[id] = true
+			}
+			if n.Data == "a" {
+				if name, ok := attrValue(n, "name"); ok && name != "" {
+					anchors[name] = true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return anchors
+}
+
+// setAnchors сохраняет якоря страницы для проверки ссылок на фрагменты
+func (s *Service) setAnchors(link string, anchors map[string]bool) {
+	s.mux.Lock()
+	s.anchors[link] = anchors
+	s.mux.Unlock()
+}
+
+// fragmentRef описывает ссылки на один фрагмент страницы
+type fragmentRef struct {
+	// Ссылка в том виде, в котором она впервые найдена (с фрагментом)
+	URL string
+	// Все места ссылки (не больше maxLinkRefs)
+	Refs []LinkRef
+}
+
+// addFragmentRef запоминает ссылку href на фрагмент fragment страницы с канонической формой key
+func (s *Service) addFragmentRef(key, fragment, href string, ref LinkRef) {
+	if !checkableFragment(fragment) {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	refs, ok := s.fragments[key]
+	if !ok {
+		refs = make(map[string]*fragmentRef)
+		s.fragments[key] = refs
+	}
+	fr, ok := refs[fragment]
+	if !ok {
+		fr = &fragmentRef{URL: href}
+		refs[fragment] = fr
+	}
+	if len(fr.Refs) < maxLinkRefs {
+		fr.Refs = append(fr.Refs, ref)
+	}
+}
+
+// checkableFragment проверяет, нужно ли искать на странице цель фрагмента.
+// Пустой фрагмент и "top" всегда ведут в начало страницы, "#!..." (hashbang) и "#:~:text=..." не являются якорями
+func checkableFragment(fragment string) bool {
+	if fragment == "" || strings.EqualFold(fragment, "top") {
+		return false
+	}
+	if strings.HasPrefix(fragment, "!") || strings.HasPrefix(fragment, ":~:") {
+		return false
+	}
+	return true
+}
+
+// fragmentErrors проверяет ссылки на фрагменты страниц, которые были загружены как HTML,
+// и добавляет ошибки для фрагментов без соответствующего якоря
+func (s *Service) fragmentErrors() {
+	type fragmentError struct {
+		link string
+		e    ErrorResult
+	}
+	errs := make([]fragmentError, 0)
+	s.mux.RLock()
+	for link, refs := range s.fragments {
+		anchors, ok := s.anchors[link]
+		if !ok {
+			// Страница не загружалась как HTML - проверить фрагменты невозможно
+			continue
+		}
+		for fragment, fr := range refs {
+			if anchors[fragment] {
+				continue
+			}
+			ref := fr.Refs[0]
+			errs = append(errs, fragmentError{
+				link: fr.URL,
+				e: ErrorResult{
+					Type:      ErrorTypeFragment,
+					Error:     "Anchor #" + fragment + " not found on the page",
+					ParentURL: ref.ParentURL,
+					Tag:       ref.Tag,
+					Attr:      ref.Attr,
+					Text:      ref.Text,
+					Line:      ref.Line,
+					Column:    ref.Column,
+					Page:      ref.Page,
+					Nofollow:  ref.Nofollow,
+					Kind:      linkKind(ref.Tag, ref.Attr, link),
+					Parents:   append([]LinkRef(nil), fr.Refs...),
+				},
+			})
+		}
+	}
+	s.mux.RUnlock()
+	for _, fe := range errs {
+		s.addError(fe.link, fe.e)
+	}
+}
@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_fragments(t *testing.T) {
+	var requests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/doc.html", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<h2 id="section-1">1</h2><a name="legacy"></a><a href="#section-1">1</a><a href="#missing-local">?</a>`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/doc.html#section-1">1</a><a href="/doc.html#legacy">legacy</a>`+
+			`<a href="/doc.html?utm_source=menu#section-3">3</a><a href="/doc.html#top">top</a><a href="/other.html">other</a>`)
+	})
+	mux.HandleFunc("/other.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/doc.html#section-3">3</a>`)
+	})
+	s := runScan(t, nil, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1, CheckFragments: true})
+
+	got := make(map[string]string)
+	for u, e := range s.Errors {
+		got[u] = fmt.Sprintf("%s %s %d", e.Type, e.ParentURL, len(e.Parents))
+	}
+	// В отчет попадает ссылка в том виде, в котором она найдена впервые, с местами всех ее повторов
+	want := map[string]string{
+		s.URL + "/doc.html?utm_source=menu#section-3": ErrorTypeFragment + " " + s.URL + "/ 2",
+		s.URL + "/doc.html#missing-local":             ErrorTypeFragment + " " + s.URL + "/doc.html 1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Errors:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Страница загружена %d раз, ожидается 1", n)
+	}
+}
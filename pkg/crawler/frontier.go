@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// errQueueFull - очередь ссылок заполнена
+var errQueueFull = errors.New("queue is full")
+
+// Сколько ссылок с начала очереди просматривает диспетчер в поисках ссылки, хост которой не ждет
+const maxDispatchScan = 1000
+
+// task описывает ссылку, ожидающую сканирования
+type task struct {
+	link     string
+	baseLink string
+	depth    int
+	// Тег и атрибут, из которых получена ссылка
+	tag  string
+	attr string
+	// Текст ссылки, ее позиция на странице или в документе, атрибут rel="nofollow"
+	text     string
+	line     int
+	column   int
+	page     int
+	nofollow bool
+	// Каноническая форма ссылки, по которой отсеиваются повторы
+	key string
+}
+
+// id возвращает каноническую форму ссылки, а если она не задана - саму ссылку
+func (t task) id() string {
+	if t.key != "" {
+		return t.key
+	}
+	return t.link
+}
+
+// host возвращает имя хоста ссылки в нижнем регистре
+func (t task) host() string {
+	u, err := url.Parse(t.link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// frontier это очередь ссылок, ожидающих сканирования (FIFO).
+// Очередь принадлежит диспетчеру (Service.run) и используется только из его горутины,
+// поэтому синхронизация не требуется.
+type frontier struct {
+	tasks []task
+	// Ссылки, отложенные обработчиками, потому что к их хосту пока нельзя отправить запрос.
+	// Раздаются раньше остальных, как только хост освободится
+	deferred []task
+	// Хосты, ссылки которых не раздаются раньше указанного времени
+	waits map[string]time.Time
+	// Ссылки, которые уже были поставлены в очередь
+	seen map[string]bool
+	// Максимальная длина очереди для найденных ссылок (-1 - без ограничения)
+	max int
+}
+
+// newFrontier возвращает пустую очередь длиной не более max (0 - по умолчанию, -1 - без ограничения)
+func newFrontier(max int) *frontier {
+	var f frontier
+	f.tasks = make([]task, 0, 64)
+	f.seen = make(map[string]bool)
+	f.waits = make(map[string]time.Time)
+	f.max = max
+	if f.max == 0 {
+		f.max = defaultMaxQueue
+	}
+	return &f
+}
+
+// push добавляет ссылку в очередь, если она еще не была туда добавлена.
+// Если очередь заполнена, новая ссылка отбрасывается и возвращается ошибка errQueueFull,
+// при этом ссылка считается уже поставленной в очередь, чтобы сообщить о ней один раз
+func (f *frontier) push(t task) (bool, error) {
+	if t.depth == 0 {
+		return false, nil
+	}
+	if _, found := f.seen[t.id()]; found {
+		return false, nil
+	}
+	f.seen[t.id()] = true
+	if f.max > 0 && f.len() >= f.max {
+		return false, errQueueFull
+	}
+	f.tasks = append(f.tasks, t)
+	return true, nil
+}
+
+// requeue добавляет ссылку в очередь повторно, даже если она уже была обработана
+func (f *frontier) requeue(t task) bool {
+	if t.depth == 0 {
+		return false
+	}
+	f.seen[t.id()] = true
+	f.tasks = append(f.tasks, t)
+	return true
+}
+
+// postpone возвращает в очередь ссылку, взятую из нее, и не раздает ссылки ее хоста до времени at
+func (f *frontier) postpone(t task, at time.Time) {
+	f.deferred = append(f.deferred, t)
+	if host := t.host(); at.After(f.waits[host]) {
+		f.waits[host] = at
+	}
+}
+
+// peek возвращает позицию первой ссылки, хост которой к моменту now не ждет, не удаляя ее из очереди.
+// Просматривает не больше maxDispatchScan ссылок, если подходящей нет, возвращает false
+func (f *frontier) peek(now time.Time) (int, bool) {
+	for i := 0; i < f.len() && i < maxDispatchScan; i++ {
+		at, ok := f.waits[f.at(i).host()]
+		if !ok || !at.After(now) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// wake возвращает время, когда освободится первый из ожидающих хостов (нулевое, если таких нет).
+// Хосты, время ожидания которых к моменту now прошло, забываются
+func (f *frontier) wake(now time.Time) time.Time {
+	var next time.Time
+	for host, at := range f.waits {
+		if !at.After(now) {
+			delete(f.waits, host)
+			continue
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next
+}
+
+// at возвращает ссылку на позиции i: сначала идут отложенные ссылки, затем остальная очередь
+func (f *frontier) at(i int) task {
+	if i < len(f.deferred) {
+		return f.deferred[i]
+	}
+	return f.tasks[i-len(f.deferred)]
+}
+
+// take удаляет из очереди и возвращает ссылку на позиции i
+func (f *frontier) take(i int) task {
+	t := f.at(i)
+	if i < len(f.deferred) {
+		f.deferred = append(f.deferred[:i], f.deferred[i+1:]...)
+		return t
+	}
+	// Ссылки перед удаляемой сдвигаются на одну позицию, просматривается только начало очереди
+	i -= len(f.deferred)
+	copy(f.tasks[1:i+1], f.tasks[:i])
+	f.tasks[0] = task{}
+	f.tasks = f.tasks[1:]
+	return t
+}
+
+// len возвращает количество ссылок в очереди вместе с отложенными
+func (f *frontier) len() int {
+	return len(f.deferred) + len(f.tasks)
+}
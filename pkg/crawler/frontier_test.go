@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+	"blc/pkg/logger"
+)
+
+func TestService_maxQueue(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			for i := 1; i <= 5; i++ {
+				fmt.Fprintf(w, `<a href="/%d">%d</a>`, i, i)
+			}
+		}
+	})
+
+	tests := []struct {
+		name     string
+		maxQueue int
+		// Ссылки, не поместившиеся в очередь
+		skipped []string
+	}{
+		{name: "limit", maxQueue: 2, skipped: []string{"/3", "/4", "/5"}},
+		{name: "no limit", maxQueue: -1, skipped: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &conf.Config{}
+			cfg.Crawler.MaxQueue = tt.maxQueue
+			s := runScan(t, cfg, handler, conf.ScheduleData{URL: []string{"/"}, Depth: 2, IgnoreRobots: true})
+
+			skipped := make([]string, 0)
+			for link, r := range s.Skipped {
+				if r.Reason != SkippedQueueFull {
+					continue
+				}
+				skipped = append(skipped, link[len(s.URL):])
+				if r.ParentURL != s.URL+"/" {
+					t.Errorf("ParentURL ссылки %s: %s", link, r.ParentURL)
+				}
+			}
+			sort.Strings(skipped)
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("Skipped: получено %v, ожидается %v", skipped, tt.skipped)
+			}
+			if want := 6 - len(tt.skipped); len(s.Processed) != want {
+				t.Errorf("Processed: %d, ожидается %d", len(s.Processed), want)
+			}
+		})
+	}
+}
+
+func TestService_workers(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	var active, maxActive int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		mu.Lock()
+		requests[r.URL.Path]++
+		if n > maxActive {
+			maxActive = n
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		// Каждая страница ссылается на все остальные
+		w.Header().Set("Content-Type", "text/html")
+		for i := 0; i < 12; i++ {
+			fmt.Fprintf(w, `<a href="/%d.html">%d</a><a href="/%d.html#top">%d</a>`, i, i, i, i)
+		}
+	})
+	cfg := &conf.Config{Crawler: conf.Crawler{Workers: 4, MaxInFlightPerHost: 4}}
+	s := runScan(t, cfg, handler, conf.ScheduleData{URL: []string{"/0.html"}, Depth: -1, IgnoreRobots: true})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxActive < 2 || maxActive > 4 {
+		t.Errorf("Одновременных запросов: %d, ожидается от 2 до 4", maxActive)
+	}
+	// Каждая страница запрашивается один раз, сколько бы обработчиков ее ни нашли
+	for path, n := range requests {
+		if n != 1 {
+			t.Errorf("%s запрошен %d раз", path, n)
+		}
+	}
+	if len(requests) != 12 || len(s.Processed) != 12 {
+		t.Errorf("Requests: %d, Processed: %d, ожидается 12", len(requests), len(s.Processed))
+	}
+}
+
+func TestService_cancel(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		time.Sleep(10 * time.Millisecond)
+		// Сайт бесконечный: каждая страница ссылается на новые
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<a href="/%d/a">a</a><a href="/%d/b">b</a>`, n, n)
+	}))
+	defer ts.Close()
+
+	chReport := make(chan *Service, 1)
+	s := New(1, &conf.Config{Crawler: conf.Crawler{Workers: 4, MaxInFlightPerHost: 4}}, chReport, logger.New(ioutil.Discard, ioutil.Discard))
+	go func() {
+		pages := 0
+		for r := range s.ChResults {
+			if r.URL != "" {
+				if pages++; pages == 10 {
+					go s.Command("CANCEL")
+				}
+			}
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		s.Scan(conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: -1, IgnoreRobots: true})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Сканирование не остановлено")
+	}
+	<-chReport
+	close(s.ChResults)
+
+	// После завершения Scan обработчики остановлены и новых запросов нет
+	n := atomic.LoadInt32(&requests)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&requests) != n {
+		t.Error("Запросы продолжаются после остановки")
+	}
+	if s.state() != STOPPED {
+		t.Errorf("Состояние: %d, ожидается STOPPED", s.state())
+	}
+}
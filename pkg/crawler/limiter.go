@@ -0,0 +1,239 @@
+package crawler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+// Параметры ограничения нагрузки по умолчанию
+const (
+	// Максимальное количество одновременных запросов к одному хосту
+	defaultMaxInFlightPerHost = 2
+	// Максимальная пауза, которую готовы выждать по заголовку Retry-After
+	defaultMaxRetryAfter = 2 * time.Minute
+	// Через сколько снова проверять хост, все места которого заняты
+	busyHostRecheck = 50 * time.Millisecond
+)
+
+// hostLimits описывает ограничения нагрузки на один хост
+type hostLimits struct {
+	// Минимальный интервал между запросами
+	interval time.Duration
+	// Максимальное количество одновременных запросов
+	maxInFlight int
+}
+
+// hostState описывает текущее состояние запросов к одному хосту
+type hostState struct {
+	// Семафор одновременных запросов
+	slots chan struct{}
+	// Время, раньше которого нельзя отправлять следующий запрос
+	next time.Time
+	// Интервал между запросами
+	interval time.Duration
+}
+
+// limiter ограничивает частоту и количество одновременных запросов к каждому хосту
+type limiter struct {
+	defaults hostLimits
+	// Переопределенные ограничения для отдельных хостов
+	overrides map[string]hostLimits
+	hosts     map[string]*hostState
+	// Максимальная пауза по заголовку Retry-After
+	maxRetryAfter time.Duration
+	mux           sync.Mutex
+}
+
+// newLimiter создает ограничитель нагрузки по настройкам из конфигурации.
+// Если RequestsPerSecond не задан, интервал между запросами к хосту равен Delay
+func newLimiter(cfg *conf.Config) *limiter {
+	var l limiter
+	l.defaults = hostLimits{
+		interval:    time.Millisecond * time.Duration(cfg.Crawler.Delay),
+		maxInFlight: cfg.Crawler.MaxInFlightPerHost,
+	}
+	if cfg.Crawler.RequestsPerSecond > 0 {
+		l.defaults.interval = rateInterval(cfg.Crawler.RequestsPerSecond)
+	}
+	if l.defaults.maxInFlight <= 0 {
+		l.defaults.maxInFlight = defaultMaxInFlightPerHost
+	}
+	l.overrides = make(map[string]hostLimits)
+	for host, h := range cfg.Host {
+		if h == nil {
+			continue
+		}
+		limits := l.defaults
+		if h.RequestsPerSecond > 0 {
+			limits.interval = rateInterval(h.RequestsPerSecond)
+		}
+		if h.MaxInFlight > 0 {
+			limits.maxInFlight = h.MaxInFlight
+		}
+		l.overrides[strings.ToLower(host)] = limits
+	}
+	l.hosts = make(map[string]*hostState)
+	l.maxRetryAfter = time.Second * time.Duration(cfg.Crawler.MaxRetryAfter)
+	if l.maxRetryAfter <= 0 {
+		l.maxRetryAfter = defaultMaxRetryAfter
+	}
+	return &l
+}
+
+// rateInterval переводит количество запросов в секунду в интервал между запросами
+func rateInterval(rps float64) time.Duration {
+	return time.Duration(float64(time.Second) / rps)
+}
+
+// state возвращает состояние хоста, создавая его при первом обращении
+func (l *limiter) state(host string) *hostState {
+	host = strings.ToLower(host)
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if h, ok := l.hosts[host]; ok {
+		return h
+	}
+	limits, ok := l.overrides[host]
+	if !ok {
+		limits = l.defaults
+	}
+	h := &hostState{
+		slots:    make(chan struct{}, limits.maxInFlight),
+		interval: limits.interval,
+	}
+	l.hosts[host] = h
+	return h
+}
+
+// acquire ждет, пока к хосту можно будет отправить запрос. Пока выдерживается пауза до следующего
+// запроса, место хоста не занимается. После выполнения запроса обязательно вызывать release
+func (l *limiter) acquire(host string) {
+	h := l.state(host)
+	for {
+		h.slots <- struct{}{}
+		d, ok := l.reserve(h)
+		if ok {
+			return
+		}
+		<-h.slots
+		time.Sleep(d)
+	}
+}
+
+// tryAcquire занимает место хоста, если запрос к нему можно отправить сразу. Иначе не ждет и возвращает
+// паузу, после которой стоит попробовать снова. После выполнения запроса обязательно вызывать release
+func (l *limiter) tryAcquire(host string) (time.Duration, bool) {
+	h := l.state(host)
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		return busyHostRecheck, false
+	}
+	d, ok := l.reserve(h)
+	if !ok {
+		<-h.slots
+	}
+	return d, ok
+}
+
+// reserve назначает следующий запрос к хосту, место которого занято, если интервал между запросами
+// уже выдержан. Иначе возвращает оставшуюся паузу
+func (l *limiter) reserve(h *hostState) (time.Duration, bool) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	if h.next.After(now) {
+		return h.next.Sub(now), false
+	}
+	h.next = now.Add(h.interval)
+	return 0, true
+}
+
+// wait ждет очереди к хосту с соблюдением интервала между запросами, не занимая места хоста
+func (l *limiter) wait(host string) {
+	h := l.state(host)
+	l.mux.Lock()
+	now := time.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(h.interval)
+	l.mux.Unlock()
+
+	time.Sleep(time.Until(at))
+}
+
+// release освобождает место для следующего запроса к хосту
+func (l *limiter) release(host string) {
+	<-l.state(host).slots
+}
+
+// block откладывает все запросы к хосту на время d
+func (l *limiter) block(host string, d time.Duration) {
+	h := l.state(host)
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if until := time.Now().Add(d); until.After(h.next) {
+		h.next = until
+	}
+}
+
+// retryAfter возвращает паузу перед повтором запроса, заданную заголовком Retry-After ответов 429 и 503.
+// Если заголовка нет, возвращает false
+func (l *limiter) retryAfter(response *http.Response) (time.Duration, bool) {
+	if response.StatusCode != http.StatusTooManyRequests && response.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	return parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+}
+
+// parseRetryAfter разбирает значение заголовка Retry-After: количество секунд или дату HTTP
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(value); err == nil {
+		if sec < 0 {
+			return 0, false
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	d := t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// slowDown увеличивает интервал между запросами к хосту до d, если текущий интервал меньше
+func (l *limiter) slowDown(host string, d time.Duration) {
+	h := l.state(host)
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if h.interval < d {
+		h.interval = d
+	}
+}
+
+// limit ждет очереди к хосту host для служебного запроса (вход на сайт, проверка soft 404) и возвращает функцию,
+// освобождающую место хоста. Если место хоста уже занято текущим обработчиком (held), второе место не занимается,
+// чтобы обработчик не ждал сам себя, но интервал между запросами соблюдается
+func (s *Service) limit(host, held string) func() {
+	if strings.EqualFold(host, held) {
+		s.limiter.wait(host)
+		return func() {}
+	}
+	s.limiter.acquire(host)
+	return func() { s.limiter.release(host) }
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 2, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"120", 120 * time.Second, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"", 0, false},
+		{"soon", 0, false},
+		{"Mon, 01 Feb 2021 10:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 01 Feb 2021 09:00:00 GMT", 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseRetryAfter(%q): получено: %v, %v, ожидается: %v, %v", tt.value, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestService_retryAfter(t *testing.T) {
+	var requests int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	started := time.Now()
+	s := runScan(t, nil, handler, conf.ScheduleData{URL: []string{"/image.png"}, Depth: 1})
+
+	if len(s.Errors) != 0 {
+		t.Errorf("Errors: получено: %v, ожидается: пусто", s.Errors)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("Requests: получено: %d, ожидается: 2", got)
+	}
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("Retry-After не выдержан: %v", elapsed)
+	}
+}
+
+func TestService_blockedHost(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]time.Time)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested["other"] = time.Now()
+		mu.Unlock()
+	}))
+	defer other.Close()
+	u, _ := url.Parse(other.URL)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = time.Now()
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/busy">busy</a><a href="/next.html">next</a>`)
+		case "/next.html":
+			// Ссылки страницы находятся, когда хост уже заблокирован
+			time.Sleep(100 * time.Millisecond)
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="/1">1</a><a href="/2">2</a><a href="/3">3</a><a href="http://localhost:%s/">other</a>`, u.Port())
+		case "/busy":
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	cfg := &conf.Config{Crawler: conf.Crawler{Workers: 2, RetryOn: []string{Retry5xx}}}
+	s := runScan(t, cfg, handler, conf.ScheduleData{URL: []string{"/"}, Depth: 3, IgnoreRobots: true})
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Ссылки заблокированного хоста откладываются, а не занимают обработчики
+	if d := requested["other"].Sub(requested["/busy"]); d > time.Second {
+		t.Errorf("Запрос ко второму хосту отправлен через %v после блокировки первого", d)
+	}
+	for _, path := range []string{"/1", "/2", "/3"} {
+		if d := requested[path].Sub(requested["/busy"]); d < 1900*time.Millisecond {
+			t.Errorf("%s запрошен через %v, Retry-After не выдержан", path, d)
+		}
+		if !s.Processed[s.URL+path] {
+			t.Errorf("%s не проверен", path)
+		}
+	}
+}
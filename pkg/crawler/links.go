@@ -0,0 +1,432 @@
+package crawler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Link это ссылка, найденная на странице, с указанием тега и атрибута, из которых она получена.
+// Для ссылок из CSS Tag - "style" (блок <style>) или "css" (CSS-файл), Attr - "url()" или "@import".
+// Для ссылок из документов Markdown, текста и PDF Tag - тип документа, Line и Page - строка или страница документа
+type Link struct {
+	URL  string
+	Tag  string
+	Attr string
+	// Текст ссылки или альтернативный текст изображения
+	Text string
+	// Строка и столбец начала тега в исходном коде HTML-страницы
+	Line   int
+	Column int
+	Page   int
+	// У ссылки атрибут rel="nofollow"
+	Nofollow bool
+}
+
+// ref возвращает место ссылки на странице parentURL
+func (l Link) ref(parentURL string) LinkRef {
+	return LinkRef{ParentURL: parentURL, Text: l.Text, Tag: l.Tag, Attr: l.Attr, Line: l.Line, Column: l.Column, Page: l.Page, Nofollow: l.Nofollow}
+}
+
+// Максимальная длина текста ссылки в символах
+const maxLinkText = 200
+
+// position это строка и столбец начала тега в исходном коде страницы
+type position struct {
+	line   int
+	column int
+}
+
+// Атрибуты тегов, содержащие ссылки
+var tagsAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"script": {"src"},
+	"img":    {"src", "srcset"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+	"base":   {"href"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+	"source": {"src", "srcset"},
+	"track":  {"src"},
+	"embed":  {"src"},
+	"object": {"data"},
+	"form":   {"action"},
+}
+
+// Ссылки с этими префиксами не проверяются
+var prohibitedPrefixes = []string{"tel:", "mailto:", "javascript:", "data:", "about:"}
+
+// Мета-теги, содержащие ссылки на изображения для социальных сетей
+var metaImages = map[string]bool{
+	"og:image":            true,
+	"og:image:url":        true,
+	"og:image:secure_url": true,
+	"twitter:image":       true,
+	"twitter:image:src":   true,
+}
+
+var (
+	// url(...) в CSS
+	cssURLRe = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"]*?))\s*\)`)
+	// @import "..." в CSS (вариант @import url(...) обрабатывается как url())
+	cssImportRe = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+)
+
+// links это список ссылок в порядке их появления на странице. Повторы ссылки остаются в списке,
+// чтобы в отчет попали все места, где она указана; сканируется ссылка один раз (см. Service.newTasks)
+type links struct {
+	list []Link
+	// Позиции тегов исходного кода страницы по ключам элементов, еще не сопоставленные с элементами дерева
+	positions map[string][]position
+}
+
+// add добавляет ссылку в список, если ее нужно проверять
+func (l *links) add(link Link) {
+	link.URL = strings.TrimSpace(link.URL)
+	if link.URL == "" || link.URL == "#" {
+		return
+	}
+	lower := strings.ToLower(link.URL)
+	for _, prefix := range prohibitedPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return
+		}
+	}
+	l.list = append(l.list, link)
+}
+
+// parsePage разбирает HTML-страницу и возвращает ее вместе с исходным кодом
+func parsePage(r io.Reader) (*html.Node, []byte, error) {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	page, err := html.Parse(bytes.NewReader(source))
+	return page, source, err
+}
+
+// pageLinks возвращает ссылки, найденные в HTML-документе, и значение href тега <base>.
+// Если передан исходный код страницы source, для ссылок указываются строка и столбец тега
+func pageLinks(n *html.Node, source []byte) ([]Link, string) {
+	l := links{list: make([]Link, 0)}
+	if source != nil {
+		l.positions = sourcePositions(source)
+	}
+	base := nodeLinks(&l, n)
+	return l.list, base
+}
+
+// elementKey возвращает ключ элемента по тегу и атрибутам, по которому элементы дерева сопоставляются с тегами исходного кода
+func elementKey(tag string, attrs []html.Attribute) string {
+	var b strings.Builder
+	b.WriteString(tag)
+	for _, a := range attrs {
+		b.WriteString("\x00" + a.Key + "=" + a.Val)
+	}
+	return b.String()
+}
+
+// sourcePositions возвращает позиции открывающих тегов исходного кода HTML по ключам элементов в порядке следования тегов
+func sourcePositions(source []byte) map[string][]position {
+	positions := make(map[string][]position)
+	z := html.NewTokenizer(bytes.NewReader(source))
+	pos := position{line: 1, column: 1}
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return positions
+		}
+		raw := z.Raw()
+		// Позиция считается до вызова Token: он переводит имя тега в нижний регистр прямо в буфере
+		next := pos
+		if i := bytes.LastIndexByte(raw, '\n'); i >= 0 {
+			next.line += bytes.Count(raw, []byte{'\n'})
+			next.column = utf8.RuneCount(raw[i+1:]) + 1
+		} else {
+			next.column += utf8.RuneCount(raw)
+		}
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			token := z.Token()
+			key := elementKey(token.Data, token.Attr)
+			positions[key] = append(positions[key], pos)
+		}
+		pos = next
+	}
+}
+
+// position возвращает позицию тега элемента n в исходном коде страницы.
+// Одинаковые элементы сопоставляются с тегами по порядку
+func (l *links) position(n *html.Node) position {
+	if l.positions == nil {
+		return position{}
+	}
+	key := elementKey(n.Data, n.Attr)
+	p := l.positions[key]
+	if len(p) == 0 {
+		return position{}
+	}
+	l.positions[key] = p[1:]
+	return p[0]
+}
+
+// linkText возвращает текст ссылки <a> (или альтернативный текст изображения в ней),
+// альтернативный текст изображения или <area>, а если его нет - aria-label или title
+func linkText(n *html.Node) string {
+	var text string
+	switch n.Data {
+	case "a":
+		text = nodeText(n)
+	case "img", "area":
+		text, _ = attrValue(n, "alt")
+	default:
+		return ""
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		text, _ = attrValue(n, "aria-label")
+	}
+	if text == "" {
+		text, _ = attrValue(n, "title")
+	}
+	if utf8.RuneCountInString(text) > maxLinkText {
+		text = string([]rune(text)[:maxLinkText]) + "..."
+	}
+	return text
+}
+
+// nodeText возвращает текст узла и его потомков. Изображения заменяются их альтернативным текстом
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style"):
+			return
+		case n.Type == html.ElementNode && n.Data == "img":
+			alt, _ := attrValue(n, "alt")
+			b.WriteString(" " + alt + " ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// nofollow проверяет, что у элемента есть атрибут rel="nofollow"
+func nofollow(n *html.Node) bool {
+	rel, _ := attrValue(n, "rel")
+	for _, v := range strings.Fields(rel) {
+		if strings.EqualFold(v, "nofollow") {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeLinks рекурсивно собирает ссылки узла и его потомков, возвращает значение href тега <base>
+func nodeLinks(l *links, n *html.Node) string {
+	var base string
+	if n.Type == html.ElementNode {
+		// Место и текст ссылки общие для всех ссылок элемента
+		pos := l.position(n)
+		context := Link{Text: linkText(n), Line: pos.line, Column: pos.column, Nofollow: nofollow(n)}
+		add := func(link Link) {
+			link.Text, link.Line, link.Column, link.Nofollow = context.Text, context.Line, context.Column, context.Nofollow
+			l.add(link)
+		}
+		for _, attr := range tagsAttrs[n.Data] {
+			val, ok := attrValue(n, attr)
+			if !ok {
+				continue
+			}
+			if attr == "srcset" {
+				for _, u := range parseSrcset(val) {
+					add(Link{URL: u, Tag: n.Data, Attr: attr})
+				}
+				continue
+			}
+			if n.Data == "base" {
+				base = val
+			}
+			add(Link{URL: val, Tag: n.Data, Attr: attr})
+		}
+		switch n.Data {
+		case "meta":
+			if equiv, _ := attrValue(n, "http-equiv"); strings.EqualFold(equiv, "refresh") {
+				content, _ := attrValue(n, "content")
+				add(Link{URL: metaRefreshURL(content), Tag: n.Data, Attr: "http-equiv=refresh"})
+			}
+			property, _ := attrValue(n, "property")
+			if property == "" {
+				property, _ = attrValue(n, "name")
+			}
+			if metaImages[strings.ToLower(property)] {
+				content, _ := attrValue(n, "content")
+				add(Link{URL: content, Tag: n.Data, Attr: strings.ToLower(property)})
+			}
+		case "style":
+			if c := n.FirstChild; c != nil && c.Type == html.TextNode {
+				for _, link := range cssLinks(c.Data, "style") {
+					add(link)
+				}
+			}
+		}
+		if style, ok := attrValue(n, "style"); ok {
+			for _, link := range cssLinks(style, n.Data) {
+				link.Attr = "style"
+				add(link)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if cbase := nodeLinks(l, c); cbase != "" {
+			base = cbase
+		}
+	}
+	return base
+}
+
+// attrValue возвращает значение атрибута узла
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// parseSrcset возвращает список URL из значения атрибута srcset: "image.jpg 1x, image-2x.jpg 2x"
+func parseSrcset(srcset string) []string {
+	const spaces = " \t\n\r\f"
+	urls := make([]string, 0)
+	s := srcset
+	for {
+		s = strings.TrimLeft(s, spaces+",")
+		if s == "" {
+			return urls
+		}
+		end := strings.IndexAny(s, spaces)
+		if end < 0 {
+			end = len(s)
+		}
+		u := s[:end]
+		s = s[end:]
+		if strings.HasSuffix(u, ",") {
+			// Кандидат без дескриптора
+			u = strings.TrimRight(u, ",")
+		} else if i := strings.Index(s, ","); i >= 0 {
+			// Пропускаем дескриптор (1x, 480w) до следующего кандидата
+			s = s[i+1:]
+		} else {
+			s = ""
+		}
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+}
+
+// metaRefreshURL возвращает URL из значения атрибута content мета-тега refresh: "5; url=/new-page.html"
+func metaRefreshURL(content string) string {
+	i := strings.Index(content, ";")
+	if i < 0 {
+		return ""
+	}
+	v := strings.TrimSpace(content[i+1:])
+	if len(v) > 3 && strings.EqualFold(v[:3], "url") {
+		v = strings.TrimSpace(v[3:])
+		if !strings.HasPrefix(v, "=") {
+			return ""
+		}
+		v = strings.TrimSpace(v[1:])
+	}
+	return strings.Trim(v, `'"`)
+}
+
+// cssLinks возвращает ссылки из url() и @import в CSS-коде
+func cssLinks(css string, tag string) []Link {
+	list := make([]Link, 0)
+	for _, m := range cssURLRe.FindAllStringSubmatch(css, -1) {
+		list = append(list, Link{URL: m[1] + m[2] + m[3], Tag: tag, Attr: "url()"})
+	}
+	for _, m := range cssImportRe.FindAllStringSubmatch(css, -1) {
+		list = append(list, Link{URL: m[1] + m[2], Tag: tag, Attr: "@import"})
+	}
+	return list
+}
+
+// linkKind возвращает описание ссылки для отчетов по тегу и атрибуту, из которых она получена
+func linkKind(tag, attr, link string) string {
+	switch {
+	case tag == "" && attr == "":
+		return ""
+	case attr == "@import":
+		return "imported stylesheet"
+	case attr == "url()" || attr == "style":
+		if imageExt(link) {
+			return "background image"
+		}
+		return "CSS resource"
+	case attr == "srcset" || tag == "img", tag == docMarkdown && attr == "image":
+		return "image"
+	case attr == "poster":
+		return "video poster"
+	case attr == "http-equiv=refresh":
+		return "meta refresh"
+	case tag == "meta":
+		return "social image (" + attr + ")"
+	}
+	switch tag {
+	case "a", "area", docMarkdown, docText, docPDF:
+		return "link"
+	case "link":
+		if ext(linkPath(link)) == ".css" {
+			return "stylesheet"
+		}
+		return "linked resource"
+	case "script":
+		return "script"
+	case "iframe", "frame":
+		return "frame"
+	case "video", "audio", "source", "track":
+		return "media"
+	case "object", "embed":
+		return "embedded object"
+	case "form":
+		return "form action"
+	case "base":
+		return "base URL"
+	}
+	return tag + " " + attr
+}
+
+// imageExt проверяет, является ли ссылка ссылкой на изображение (по расширению файла)
+func imageExt(link string) bool {
+	switch ext(linkPath(link)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".svg", ".avif", ".bmp", ".ico":
+		return true
+	}
+	return false
+}
+
+// linkPath возвращает путь ссылки без параметров и фрагмента
+func linkPath(link string) string {
+	if i := strings.IndexAny(link, "?#"); i >= 0 {
+		link = link[:i]
+	}
+	return strings.ToLower(path.Clean("/" + link))
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"blc/pkg/conf"
+)
+
+func Test_pageLinks(t *testing.T) {
+	doc := `<html><head>
+<meta http-equiv="refresh" content="5; URL='/moved.html'">
+<meta property="og:image" content="/og.png">
+<meta name="twitter:image" content="/tw.png">
+<style>body { background: url("/bg.jpg"); } @import 'print.css';</style>
+</head><body>
+<a href="/page.html">page</a>
+<a href="#top">top</a>
+<img src="a.jpg" srcset="a-1x.jpg 1x, a-2x.jpg 2x,a-3x.jpg">
+<picture><source srcset="pic.webp"></picture>
+<video src="v.mp4" poster="poster.jpg"><track src="subs.vtt"></video>
+<audio><source src="a.mp3"></audio>
+<object data="movie.swf"></object>
+<form action="/search"></form>
+<div style="background-image: url(div.png)"></div>
+<a href="mailto:test@example.com">mail</a>
+<img src="data:image/png;base64,AAAA">
+<p>Текст <a href="/nf" rel="external nofollow">
+  <img src="icon.png" alt="Icon"> home</a></p>
+</body></html>`
+	page, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, _ := pageLinks(page, []byte(doc))
+	got := make([]string, 0, len(links))
+	for _, l := range links {
+		got = append(got, l.URL+" "+l.Tag+"/"+l.Attr)
+	}
+	want := []string{
+		"/moved.html meta/http-equiv=refresh",
+		"/og.png meta/og:image",
+		"/tw.png meta/twitter:image",
+		"/bg.jpg style/url()",
+		"print.css style/@import",
+		"/page.html a/href",
+		"#top a/href",
+		"a.jpg img/src",
+		"a-1x.jpg img/srcset",
+		"a-2x.jpg img/srcset",
+		"a-3x.jpg img/srcset",
+		"pic.webp source/srcset",
+		"v.mp4 video/src",
+		"poster.jpg video/poster",
+		"subs.vtt track/src",
+		"a.mp3 source/src",
+		"movie.swf object/data",
+		"/search form/action",
+		"div.png div/style",
+		"/nf a/href",
+		"icon.png img/src",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pageLinks:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+
+	// Текст ссылки, позиция тега (столбцы считаются в символах) и rel="nofollow"
+	context := make(map[string]string)
+	for _, l := range links {
+		context[l.URL] = fmt.Sprintf("%d:%d %q %v", l.Line, l.Column, l.Text, l.Nofollow)
+	}
+	for link, want := range map[string]string{
+		"/page.html": `7:1 "page" false`,
+		"/bg.jpg":    `5:1 "" false`,
+		"a-2x.jpg":   `9:1 "" false`,
+		"/nf":        `18:10 "Icon home" true`,
+		"icon.png":   `19:3 "Icon" false`,
+	} {
+		if context[link] != want {
+			t.Errorf("Context of %s: получено: %s, ожидается: %s", link, context[link], want)
+		}
+	}
+	if kind := linkKind("div", "style", "div.png"); kind != "background image" {
+		t.Errorf("linkKind: получено: %q, ожидается: %q", kind, "background image")
+	}
+}
+
+func TestService_cssLinks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/css/site.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		fmt.Fprint(w, `@import url("fonts.css"); .hero { background: url(../img/missing.png) }`)
+	})
+	mux.HandleFunc("/css/fonts.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<link rel="stylesheet" href="/css/site.css">`)
+	})
+	s := runScan(t, nil, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1})
+
+	if _, ok := s.Processed[s.URL+"/css/fonts.css"]; !ok {
+		t.Errorf("Processed: нет ссылки из @import %s", s.URL+"/css/fonts.css")
+	}
+	e, ok := s.Errors[s.URL+"/img/missing.png"]
+	if !ok || e.Kind != "background image" || e.ParentURL != s.URL+"/css/site.css" {
+		t.Errorf("Errors: получено: %v, ожидается: background image на %s", s.Errors, s.URL+"/css/site.css")
+	}
+}
+
+func TestService_linkContext(t *testing.T) {
+	var missing int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			// Битая ссылка указана на странице дважды
+			fmt.Fprint(w, "<html><body>\n<p><a href=\"/missing\" rel=\"nofollow\">Broken  link</a></p>\n<a href=\"/late\">late</a> <a href=\"/ok\">ok</a>\n<a href=\"/missing\">again</a>\n</body></html>")
+		case "/late":
+			// Страница разбирается после того, как ошибка уже опубликована
+			fmt.Fprint(w, "<a href=\"/ok\">ok</a>\n\n  <img src=\"/missing\" alt=\"Logo\">")
+		case "/ok":
+			fmt.Fprint(w, "ok")
+		case "/missing":
+			atomic.AddInt32(&missing, 1)
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	s := runScan(t, nil, handler, conf.ScheduleData{URL: []string{"/"}, Depth: -1})
+	if n := atomic.LoadInt32(&missing); n != 1 {
+		t.Errorf("Битая ссылка запрошена %d раз, ожидается 1", n)
+	}
+	var streamed ScanResult
+	for _, r := range s.Results {
+		if r.URL == s.URL+"/missing" {
+			streamed = r
+		}
+	}
+
+	e, ok := s.Errors[s.URL+"/missing"]
+	if !ok {
+		t.Fatalf("Errors: %v", s.Errors)
+	}
+	first := LinkRef{ParentURL: s.URL + "/", Text: "Broken link", Tag: "a", Attr: "href", Line: 2, Column: 4, Nofollow: true}
+	want := []LinkRef{first, {ParentURL: s.URL + "/", Text: "again", Tag: "a", Attr: "href", Line: 4, Column: 1},
+		{ParentURL: s.URL + "/late", Text: "Logo", Tag: "img", Attr: "src", Line: 3, Column: 3}}
+	if !reflect.DeepEqual(e.Parents, want) {
+		t.Errorf("Parents:\r\nполучено: %+v\r\nожидается: %+v", e.Parents, want)
+	}
+	if e.Text != first.Text || e.Line != first.Line || e.Column != first.Column || !e.Nofollow {
+		t.Errorf("Error context: %+v", e)
+	}
+	if streamed.Text != first.Text || streamed.Line != first.Line || streamed.Column != first.Column || !streamed.Nofollow ||
+		!reflect.DeepEqual(streamed.Parents, want[:2]) {
+		t.Errorf("Streamed result: %+v", streamed)
+	}
+	if refs, ok := s.refs[s.canonical(s.URL+"/ok")]; !ok || refs != nil {
+		t.Errorf("References of a working link are kept: %v", refs)
+	}
+}
@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"blc/pkg/conf"
+)
+
+// Режимы запроса ссылок, которые по расширению не являются HTML-страницами
+const (
+	// NonHTMLHead - запрос HEAD
+	NonHTMLHead = "head"
+	// NonHTMLGet - запрос GET начала файла (не больше MaxNonHTMLBody байт)
+	NonHTMLGet = "get"
+)
+
+// Параметры выбора метода по умолчанию
+var (
+	// Коды ответа на HEAD, после которых ссылка запрашивается GET
+	defaultHeadFallback = []statusRange{{400, 400}, {403, 403}, {404, 404}, {405, 405}, {501, 501}}
+	// Сколько байт тела читается при запросе GET файлов, не являющихся HTML-страницами
+	defaultMaxNonHTMLBody int64 = 64 * 1024
+)
+
+// methodPolicy определяет, каким методом запрашивать ссылки
+type methodPolicy struct {
+	fallback   []statusRange
+	nonHTMLGet bool
+	bodyLimit  int64
+	// Метод, заданный для хоста
+	hosts map[string]string
+}
+
+// CheckMethods проверяет настройки выбора метода запроса из конфигурации
+func CheckMethods(cfg *conf.Config) error {
+	_, err := newMethodPolicy(cfg)
+	return err
+}
+
+// newMethodPolicy возвращает политику выбора метода из конфигурации
+func newMethodPolicy(cfg *conf.Config) (methodPolicy, error) {
+	p := methodPolicy{
+		fallback:  defaultHeadFallback,
+		bodyLimit: int64(cfg.Crawler.MaxNonHTMLBody),
+		hosts:     make(map[string]string),
+	}
+	if len(cfg.Crawler.HeadFallback) > 0 {
+		p.fallback = nil
+		for _, st := range cfg.Crawler.HeadFallback {
+			sr, err := parseStatusRange(st)
+			if err != nil {
+				return p, fmt.Errorf("HEAD fallback: %v", err)
+			}
+			p.fallback = append(p.fallback, sr)
+		}
+	}
+	switch strings.ToLower(cfg.Crawler.NonHTMLMethod) {
+	case "", NonHTMLHead:
+	case NonHTMLGet:
+		p.nonHTMLGet = true
+	default:
+		return p, fmt.Errorf("unknown non-HTML method %q", cfg.Crawler.NonHTMLMethod)
+	}
+	if p.bodyLimit <= 0 {
+		p.bodyLimit = defaultMaxNonHTMLBody
+	}
+	for host, h := range cfg.Host {
+		if h == nil || h.Method == "" {
+			continue
+		}
+		m := strings.ToUpper(h.Method)
+		if m != http.MethodGet && m != http.MethodHead {
+			return p, fmt.Errorf("host %s: unsupported method %q", host, h.Method)
+		}
+		p.hosts[strings.ToLower(host)] = m
+	}
+	return p, nil
+}
+
+// method возвращает метод запроса ссылки u и признак того, что метод задан для хоста и менять его нельзя
+func (p methodPolicy) method(u *url.URL) (string, bool) {
+	if m, ok := p.hosts[strings.ToLower(u.Host)]; ok {
+		return m, true
+	}
+	m := method(u.String())
+	if m == http.MethodHead && p.nonHTMLGet {
+		m = http.MethodGet
+	}
+	return m, false
+}
+
+// headFallback проверяет, нужно ли после ответа на HEAD повторить запрос методом GET
+func (p methodPolicy) headFallback(status int) bool {
+	for _, sr := range p.fallback {
+		if status >= sr.from && status <= sr.to {
+			return true
+		}
+	}
+	return false
+}
+
+// parsable проверяет, нужно ли разбирать ответ с типом docType по ссылке link: HTML-страницы, CSS и документы,
+// в которых ищутся ссылки. Для ссылок, которые не сканируются дальше, нужны только якоря HTML-страниц
+func (s *Service) parsable(t task, docType string) bool {
+	switch documentType(docType, t.link) {
+	case "":
+		return false
+	case docHTML:
+		return t.depth != 1 || s.checkFragments
+	}
+	return t.depth != 1
+}
+
+// fetch выполняет запрос request к ссылке t, меняя метод при необходимости:
+// - если сервер ответил на HEAD кодом из списка HeadFallback, ссылка запрашивается GET (только начало файла);
+// - если по ответу на HEAD или на запрос начала файла видно, что это HTML-страница, CSS или документ со ссылками,
+// которые нужно разобрать, ссылка запрашивается GET целиком.
+// При запросе начала файла читается не больше MaxNonHTMLBody байт тела. forced - метод задан для хоста.
+// Возвращает ответ, метод, которым он получен, и историю попыток всех запросов.
+// Место хоста в ограничителе занимает и освобождает вызывающий код
+func (s *Service) fetch(request *http.Request, t task, forced bool, host string) (*http.Response, string, []Attempt, error) {
+	// GET для ссылок, которые по расширению не являются HTML-страницами, запрашивает только начало файла
+	ranged := request.Method == http.MethodGet && method(t.link) == http.MethodHead
+	if ranged {
+		request.Header.Set("Range", fmt.Sprintf("bytes=0-%d", s.methods.bodyLimit-1))
+	}
+	response, attempts, err := s.do(s.client, request, host)
+	repeat := func(m string, r bool) {
+		response.Body.Close()
+		s.limiter.release(host)
+		s.limiter.acquire(host)
+		request = request.Clone(request.Context())
+		request.Method, ranged = m, r
+		request.Header.Del("Range")
+		if ranged {
+			request.Header.Set("Range", fmt.Sprintf("bytes=0-%d", s.methods.bodyLimit-1))
+		}
+		var more []Attempt
+		response, more, err = s.do(s.client, request, host)
+		attempts = append(attempts, more...)
+	}
+	if err == nil && !forced && request.Method == http.MethodHead && s.methods.headFallback(response.StatusCode) {
+		repeat(http.MethodGet, true)
+	}
+	// Пустые файлы не отдаются по частям
+	if err == nil && ranged && response.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		repeat(http.MethodGet, false)
+	}
+	if err == nil && (request.Method == http.MethodHead || ranged) && !(forced && request.Method == http.MethodHead) &&
+		response.StatusCode < 300 && s.parsable(t, response.Header.Get("Content-Type")) {
+		repeat(http.MethodGet, false)
+	}
+	if err != nil {
+		return nil, request.Method, attempts, err
+	}
+	response.Body = countingReader{ReadCloser: response.Body, n: &s.budget.bytes}
+	if ranged && response.StatusCode < 300 {
+		// Файл должен отдаваться без ошибок, но целиком его не читаем
+		if _, err := io.Copy(ioutil.Discard, io.LimitReader(response.Body, s.methods.bodyLimit)); err != nil {
+			response.Body.Close()
+			return nil, request.Method, attempts, err
+		}
+	}
+	return response, request.Method, attempts, nil
+}
+
+// lastMethodAttempts возвращает попытки запроса последним использованным методом
+func lastMethodAttempts(attempts []Attempt) []Attempt {
+	for i := len(attempts) - 1; i > 0; i-- {
+		if attempts[i-1].Method != attempts[i].Method {
+			return attempts[i:]
+		}
+	}
+	return attempts
+}
@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_methods(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string][]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		m := r.Method
+		if r.Header.Get("Range") != "" {
+			m += " range"
+		}
+		mu.Lock()
+		requests[r.URL.Path] = append(requests[r.URL.Path], m)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/file.pdf">pdf</a><a href="/gone.pdf">gone</a><a href="/page.php">php</a>`+
+				`<a href="/doc.zip">zip</a><a href="/empty.txt">empty</a>`)
+		case "/file.pdf", "/gone.pdf":
+			// Сервер не поддерживает HEAD
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if r.URL.Path == "/gone.pdf" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF")
+		case "/page.php":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/inner.html">inner</a>`)
+		case "/inner.html":
+			w.Header().Set("Content-Type", "text/html")
+		case "/doc.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			if r.Header.Get("Range") != "" {
+				w.Header().Set("Content-Range", "bytes 0-3/100000")
+				w.WriteHeader(http.StatusPartialContent)
+			}
+			fmt.Fprint(w, "PK..")
+		case "/empty.txt":
+			if r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			}
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		cfg      conf.Config
+		requests map[string][]string
+		// Битые ссылки и методы, которыми получен ответ
+		errors map[string]string
+	}{
+		{
+			name: "default",
+			// Внутренние документы PDF и текстовые файлы запрашиваются целиком, чтобы найти в них ссылки
+			requests: map[string][]string{
+				"/":           {"GET"},
+				"/file.pdf":   {"HEAD", "GET range", "GET"},
+				"/gone.pdf":   {"HEAD", "GET range"},
+				"/page.php":   {"HEAD", "GET"},
+				"/inner.html": {"GET"},
+				"/doc.zip":    {"HEAD"},
+				"/empty.txt":  {"HEAD", "GET"},
+			},
+			errors: map[string]string{"/gone.pdf": "GET"},
+		},
+		{
+			// Страницы, запрошенные HEAD, не разбираются
+			name:     "host HEAD",
+			cfg:      conf.Config{Host: map[string]*conf.Host{strings.TrimPrefix(ts.URL, "http://"): {Method: "head"}}},
+			requests: map[string][]string{"/": {"HEAD"}},
+			errors:   map[string]string{},
+		},
+		{
+			name: "host GET",
+			cfg:  conf.Config{Host: map[string]*conf.Host{strings.TrimPrefix(ts.URL, "http://"): {Method: "GET"}}},
+			requests: map[string][]string{
+				"/":           {"GET"},
+				"/file.pdf":   {"GET range", "GET"},
+				"/gone.pdf":   {"GET range"},
+				"/page.php":   {"GET range", "GET"},
+				"/inner.html": {"GET"},
+				"/doc.zip":    {"GET range"},
+				"/empty.txt":  {"GET range", "GET"},
+			},
+			errors: map[string]string{"/gone.pdf": "GET"},
+		},
+		{
+			name: "non-HTML GET",
+			cfg:  conf.Config{Crawler: conf.Crawler{NonHTMLMethod: NonHTMLGet, MaxNonHTMLBody: 2}},
+			requests: map[string][]string{
+				"/":           {"GET"},
+				"/file.pdf":   {"GET range", "GET"},
+				"/gone.pdf":   {"GET range"},
+				"/page.php":   {"GET range", "GET"},
+				"/inner.html": {"GET"},
+				"/doc.zip":    {"GET range"},
+				"/empty.txt":  {"GET range", "GET"},
+			},
+			errors: map[string]string{"/gone.pdf": "GET"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckMethods(&tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			requests = make(map[string][]string)
+			mu.Unlock()
+			s := runScan(t, &tt.cfg, nil, conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: 3, IgnoreRobots: true})
+
+			mu.Lock()
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("Requests:\r\nполучено: %v\r\nожидается: %v", requests, tt.requests)
+			}
+			mu.Unlock()
+			errs := make(map[string]string)
+			for u, e := range s.Errors {
+				errs[strings.TrimPrefix(u, ts.URL)] = e.Method
+			}
+			if !reflect.DeepEqual(errs, tt.errors) {
+				t.Errorf("Errors:\r\nполучено: %v\r\nожидается: %v", errs, tt.errors)
+			}
+		})
+	}
+
+	if err := CheckMethods(&conf.Config{Host: map[string]*conf.Host{"example.com": {Method: "POST"}}}); err == nil {
+		t.Error("Ожидается ошибка для метода POST")
+	}
+}
@@ -0,0 +1,237 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"blc/pkg/conf"
+)
+
+// Политики завершающего слэша в пути
+const (
+	// TrailingSlashKeep - путь не меняется
+	TrailingSlashKeep = "keep"
+	// TrailingSlashAdd - слэш добавляется к путям, последний сегмент которых не похож на файл
+	TrailingSlashAdd = "add"
+	// TrailingSlashRemove - слэш удаляется (кроме корня сайта)
+	TrailingSlashRemove = "remove"
+)
+
+// Параметры запроса, которые по умолчанию удаляются из URL: метки рекламных и аналитических систем
+var defaultStripParams = []string{"utm_*", "fbclid", "gclid", "yclid", "msclkid", "_openstat"}
+
+// Normalizer приводит URL к канонической форме. Ссылки с одинаковой канонической формой сканируются один раз
+type Normalizer interface {
+	Normalize(u *url.URL) string
+}
+
+// URLNormalizer это нормализатор URL с настройками из конфигурации
+type URLNormalizer struct {
+	trailingSlash string
+	// Шаги нормализации, включенные по умолчанию
+	defaultPort bool
+	hostCase    bool
+	encoding    bool
+	sortQuery   bool
+	// Приведение пути к нижнему регистру (для серверов, не различающих регистр)
+	pathCase bool
+	// Удаляемые параметры запроса: точные имена и префиксы (шаблоны вида "utm_*")
+	strip       map[string]bool
+	stripPrefix []string
+}
+
+// Экранированный слэш в пути нельзя раскодировать, не изменив путь
+var escapedSlashRe = regexp.MustCompile(`(?i)%2f`)
+
+// NewNormalizer возвращает нормализатор URL по настройкам из конфигурации
+func NewNormalizer(cfg conf.Normalize) *URLNormalizer {
+	n := URLNormalizer{
+		trailingSlash: strings.ToLower(cfg.TrailingSlash),
+		defaultPort:   !cfg.KeepDefaultPort,
+		hostCase:      !cfg.KeepHostCase,
+		encoding:      !cfg.KeepEncoding,
+		sortQuery:     !cfg.KeepQueryOrder,
+		pathCase:      cfg.FoldPathCase,
+		strip:         make(map[string]bool),
+	}
+	params := cfg.StripParam
+	if len(params) == 0 {
+		params = defaultStripParams
+	}
+	for _, p := range params {
+		p = strings.ToLower(strings.TrimSpace(p))
+		switch {
+		case p == "-":
+			// "-" отключает удаление параметров
+		case strings.HasSuffix(p, "*"):
+			n.stripPrefix = append(n.stripPrefix, strings.TrimSuffix(p, "*"))
+		case p != "":
+			n.strip[p] = true
+		}
+	}
+	return &n
+}
+
+// Normalize возвращает каноническую форму URL (без фрагмента)
+func (n *URLNormalizer) Normalize(u *url.URL) string {
+	c := *u
+	c.Fragment = ""
+	c.RawFragment = ""
+	if n.hostCase {
+		c.Host = strings.ToLower(c.Host)
+	}
+	if n.defaultPort {
+		port := c.Port()
+		if (c.Scheme == "http" && port == "80") || (c.Scheme == "https" && port == "443") {
+			c.Host = strings.TrimSuffix(c.Host, ":"+port)
+		}
+	}
+	if c.Host != "" && c.Path == "" {
+		c.Path = "/"
+	}
+	if n.encoding {
+		if escapedSlashRe.MatchString(c.RawPath) {
+			c.RawPath = normalizeEscapes(c.RawPath)
+		} else {
+			// Путь будет заново закодирован в стандартной форме
+			c.RawPath = ""
+		}
+	}
+	switch n.trailingSlash {
+	case TrailingSlashAdd:
+		if !strings.HasSuffix(c.Path, "/") && !strings.Contains(c.Path[strings.LastIndex(c.Path, "/")+1:], ".") {
+			c.Path += "/"
+			c.RawPath = ""
+		}
+	case TrailingSlashRemove:
+		if len(c.Path) > 1 && strings.HasSuffix(c.Path, "/") {
+			c.Path = strings.TrimRight(c.Path, "/")
+			if c.Path == "" {
+				c.Path = "/"
+			}
+			c.RawPath = ""
+		}
+	}
+	if n.pathCase {
+		c.Path = strings.ToLower(c.Path)
+		c.RawPath = strings.ToLower(c.RawPath)
+	}
+	c.RawQuery = n.query(c.RawQuery)
+	c.ForceQuery = false
+	return c.String()
+}
+
+// query удаляет из строки запроса лишние параметры и сортирует оставшиеся по имени
+func (n *URLNormalizer) query(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	params := strings.Split(raw, "&")
+	kept := make([]string, 0, len(params))
+	for _, p := range params {
+		if p == "" {
+			continue
+		}
+		name := p
+		if i := strings.Index(p, "="); i >= 0 {
+			name = p[:i]
+		}
+		if n.stripped(name) {
+			continue
+		}
+		if n.encoding {
+			p = normalizeEscapes(p)
+		}
+		kept = append(kept, p)
+	}
+	if n.sortQuery {
+		// Стабильная сортировка по имени сохраняет порядок повторяющихся параметров
+		sort.SliceStable(kept, func(i, j int) bool {
+			return paramName(kept[i]) < paramName(kept[j])
+		})
+	}
+	return strings.Join(kept, "&")
+}
+
+// stripped проверяет, нужно ли удалить параметр запроса
+func (n *URLNormalizer) stripped(name string) bool {
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		name = unescaped
+	}
+	name = strings.ToLower(name)
+	if n.strip[name] {
+		return true
+	}
+	for _, prefix := range n.stripPrefix {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// paramName возвращает имя параметра запроса "name=value"
+func paramName(p string) string {
+	if i := strings.Index(p, "="); i >= 0 {
+		return p[:i]
+	}
+	return p
+}
+
+// normalizeEscapes раскодирует незарезервированные символы (RFC 3986) и приводит остальные
+// последовательности %XX к верхнему регистру
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !ishex(s[i+1]) || !ishex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if unreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func ishex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// unreserved проверяет, является ли символ незарезервированным (RFC 3986, раздел 2.3)
+func unreserved(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// canonical возвращает каноническую форму ссылки. Если ссылку не удается разобрать, она остается без изменений
+func (s *Service) canonical(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return s.normalizer.Normalize(u)
+}
+
+// SetNormalizer заменяет нормализатор URL. Вызывать до начала сканирования
+func (s *Service) SetNormalizer(n Normalizer) {
+	s.normalizer = n
+}
@@ -0,0 +1,90 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestURLNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  conf.Normalize
+		link string
+		want string
+	}{
+		{"host case and default port", conf.Normalize{}, "HTTP://Example.COM:80", "http://example.com/"},
+		{"https default port", conf.Normalize{}, "https://example.com:443/a", "https://example.com/a"},
+		{"non-default port", conf.Normalize{}, "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"keep default port", conf.Normalize{KeepDefaultPort: true, KeepHostCase: true}, "http://Example.com:80/", "http://Example.com:80/"},
+		{"fragment", conf.Normalize{}, "http://example.com/a#top", "http://example.com/a"},
+		{"query order and tracking", conf.Normalize{}, "http://example.com/?b=2&utm_source=x&a=1&fbclid=y&a=0", "http://example.com/?a=1&a=0&b=2"},
+		{"keep query order", conf.Normalize{KeepQueryOrder: true}, "http://example.com/?b=2&a=1", "http://example.com/?b=2&a=1"},
+		{"custom strip list", conf.Normalize{StripParam: []string{"sid", "ref_*"}}, "http://example.com/?utm_source=x&sid=1&ref_a=2&q=3", "http://example.com/?q=3&utm_source=x"},
+		{"no stripping", conf.Normalize{StripParam: []string{"-"}}, "http://example.com/?utm_source=x", "http://example.com/?utm_source=x"},
+		{"empty query", conf.Normalize{}, "http://example.com/a?", "http://example.com/a"},
+		{"encoding", conf.Normalize{}, "http://example.com/%7euser/a%2fb?q=%7e%2f", "http://example.com/~user/a%2Fb?q=~%2F"},
+		{"decoded path", conf.Normalize{}, "http://example.com/%61bc", "http://example.com/abc"},
+		{"keep encoding", conf.Normalize{KeepEncoding: true}, "http://example.com/?q=%7e", "http://example.com/?q=%7e"},
+		{"add slash", conf.Normalize{TrailingSlash: TrailingSlashAdd}, "http://example.com/dir", "http://example.com/dir/"},
+		{"add slash to file", conf.Normalize{TrailingSlash: TrailingSlashAdd}, "http://example.com/page.html", "http://example.com/page.html"},
+		{"remove slash", conf.Normalize{TrailingSlash: TrailingSlashRemove}, "http://example.com/dir/", "http://example.com/dir"},
+		{"remove slash from root", conf.Normalize{TrailingSlash: TrailingSlashRemove}, "http://example.com/", "http://example.com/"},
+		{"keep slash", conf.Normalize{}, "http://example.com/dir/", "http://example.com/dir/"},
+		{"path case", conf.Normalize{FoldPathCase: true}, "http://example.com/Dir/Page.HTML?Q=A", "http://example.com/dir/page.html?Q=A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := NewNormalizer(tt.cfg).Normalize(u); got != tt.want {
+				t.Errorf("Normalize(%s):\r\nполучено: %s\r\nожидается: %s", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_normalize(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/list?b=2&a=1&utm_source=news">list</a><a href="/list?a=1&b=2">list</a>`+
+				`<a href="/dir">dir</a><a href="/dir/">dir</a><a href="/missing?utm_campaign=spring">missing</a>`+
+				`<a href="/missing#top">missing</a><a href="/%6Dissing">missing</a>`)
+		case "/list", "/dir", "/dir/":
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	cfg := &conf.Config{}
+	cfg.Normalize.TrailingSlash = TrailingSlashAdd
+	s := runScan(t, cfg, nil, conf.ScheduleData{URL: []string{ts.URL}, Depth: 2})
+
+	// Запрашивается ссылка в том виде, в котором она встретилась первой
+	want := map[string]int{"/robots.txt": 1, "/": 1, "/list": 1, "/dir": 1, "/missing": 1}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("Requests:\r\nполучено: %v\r\nожидается: %v", requests, want)
+	}
+	if _, ok := s.Errors[ts.URL+"/missing?utm_campaign=spring"]; !ok || len(s.Errors) != 1 {
+		t.Errorf("Errors: %v", s.Errors)
+	}
+}
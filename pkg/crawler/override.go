@@ -0,0 +1,190 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"blc/pkg/conf"
+)
+
+// Порт в подмене адреса, подходящий для любого порта
+const anyPort = "*"
+
+// dialFunc устанавливает соединение
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// hostOverrides подменяет адреса хостов при установке соединения, как curl --resolve:
+// URL, заголовок Host и имя сервера TLS остаются прежними
+type hostOverrides struct {
+	mux sync.RWMutex
+	// "host:port" или "host:*" -> адрес
+	addrs map[string]string
+}
+
+// rewriteRule заменяет начало URL from на to перед запросом
+type rewriteRule struct {
+	from string
+	to   string
+}
+
+// CheckOverrides проверяет подмены адресов и правила замены URL сканирования
+func CheckOverrides(sched conf.ScheduleData) error {
+	if err := newHostOverrides().add(sched.Resolve); err != nil {
+		return err
+	}
+	_, err := parseRewrites(sched.Rewrite)
+	return err
+}
+
+// newHostOverrides возвращает пустой набор подмен адресов
+func newHostOverrides() *hostOverrides {
+	return &hostOverrides{addrs: make(map[string]string)}
+}
+
+// add добавляет подмены адресов "host:port:address", заменяя уже заданные для тех же хоста и порта
+func (o *hostOverrides) add(entries []string) error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	for _, entry := range entries {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return fmt.Errorf("resolve %q: expected host:port:address", entry)
+		}
+		if parts[1] != anyPort {
+			if port, err := strconv.Atoi(parts[1]); err != nil || port <= 0 || port > 65535 {
+				return fmt.Errorf("resolve %q: invalid port %q", entry, parts[1])
+			}
+		}
+		// IPv6-адреса записываются в квадратных скобках
+		o.addrs[strings.ToLower(parts[0])+":"+parts[1]] = strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+	}
+	return nil
+}
+
+// lookup возвращает адрес, подмененный для хоста host и порта port
+func (o *hostOverrides) lookup(host, port string) (string, bool) {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+	host = strings.ToLower(host)
+	if addr, ok := o.addrs[host+":"+port]; ok {
+		return addr, true
+	}
+	addr, ok := o.addrs[host+":"+anyPort]
+	return addr, ok
+}
+
+// dial возвращает функцию установки соединения, которая подключается к подмененным адресам.
+// При работе через прокси подменяется только адрес прокси
+func (o *hostOverrides) dial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(addr); err == nil {
+			if override, ok := o.lookup(host, port); ok {
+				addr = net.JoinHostPort(override, port)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// parseRewrites разбирает правила замены URL "from to"
+func parseRewrites(entries []string) ([]rewriteRule, error) {
+	rules := make([]rewriteRule, 0, len(entries))
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("rewrite %q: expected \"from to\"", entry)
+		}
+		for _, f := range fields {
+			if u, err := url.Parse(f); err != nil || !u.IsAbs() || u.Host == "" {
+				return nil, fmt.Errorf("rewrite %q: %q is not an absolute URL", entry, f)
+			}
+		}
+		rules = append(rules, rewriteRule{from: fields[0], to: fields[1]})
+	}
+	return rules, nil
+}
+
+// apply заменяет начало ссылки link. Начало должно заканчиваться на границе хоста или сегмента пути
+func (r rewriteRule) apply(link string) (string, bool) {
+	if !strings.HasPrefix(link, r.from) {
+		return "", false
+	}
+	rest := link[len(r.from):]
+	if rest != "" && !strings.HasSuffix(r.from, "/") && !strings.ContainsAny(rest[:1], "/?#") {
+		return "", false
+	}
+	return r.to + rest, true
+}
+
+// setupOverrides добавляет подмены адресов и правила замены URL сканирования к заданным в настройках HTTP
+func (s *Service) setupOverrides(sched conf.ScheduleData) {
+	if err := s.overrides.add(sched.Resolve); err != nil {
+		s.logger.Error(fmt.Sprintf("Resolve, ID: %d: %v", s.ID, err))
+	}
+	rules, err := parseRewrites(sched.Rewrite)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Rewrite, ID: %d: %v", s.ID, err))
+	}
+	// Правила сканирования проверяются раньше общих
+	s.rewrites = append(rules, s.rewrites...)
+}
+
+// rewrite возвращает копию запроса, направленную по адресу, полученному первым подходящим правилом замены URL.
+// Если ни одно правило не подходит, возвращает сам запрос
+func (s *Service) rewrite(request *http.Request) *http.Request {
+	for _, r := range s.rewrites {
+		link, ok := r.apply(request.URL.String())
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			return request
+		}
+		rewritten := request.Clone(request.Context())
+		rewritten.URL, rewritten.Host = u, ""
+		return rewritten
+	}
+	return request
+}
+
+// unrewrite переводит замененный адрес link обратно в исходный по первому подходящему правилу замены URL
+func (s *Service) unrewrite(link string) (string, bool) {
+	for _, r := range s.rewrites {
+		if original, ok := (rewriteRule{from: r.to, to: r.from}).apply(link); ok {
+			return original, true
+		}
+	}
+	return "", false
+}
+
+// rewriteTransport выполняет запросы клиента сканирования исполнителем s.fetcher по правилам замены URL.
+// Ответ возвращается с исходным запросом, а перенаправление на замененный адрес переводится обратно
+// в исходный, поэтому клиент, авторизация, проверки и отчеты видят только исходные URL
+type rewriteTransport struct {
+	s *Service
+}
+
+// RoundTrip выполняет запрос по замененному адресу
+func (t rewriteTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	rewritten := t.s.rewrite(request)
+	response, err := t.s.fetcher.RoundTrip(rewritten)
+	if err != nil || rewritten == request {
+		return response, err
+	}
+	response.Request = request
+	if location := response.Header.Get("Location"); location != "" {
+		if u, err := rewritten.URL.Parse(location); err == nil && u.IsAbs() {
+			if original, ok := t.s.unrewrite(u.String()); ok {
+				response.Header.Set("Location", original)
+			}
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,192 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_overrides(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Host+r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="https://www.example.com/page">page</a> <a href="https://www.example.com/missing">missing</a>`)
+		case "/page":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	tests := []struct {
+		name  string
+		cfg   conf.Config
+		sched conf.ScheduleData
+		// Запросы, полученные сервером (Host и путь), и битые ссылки
+		requests []string
+		errors   []string
+	}{
+		{
+			// Абсолютные ссылки на рабочий хост считаются внутренними и запрашиваются с тестового адреса
+			name: "resolve",
+			cfg:  conf.Config{HTTP: conf.HTTP{Resolve: []string{"www.example.com:443:192.0.2.1"}}},
+			sched: conf.ScheduleData{
+				URL:     []string{"http://www.example.com:" + u.Port() + "/"},
+				Resolve: []string{"www.example.com:*:" + u.Hostname()},
+				Rewrite: []string{"https://www.example.com http://www.example.com:" + u.Port()},
+			},
+			requests: []string{"www.example.com:" + u.Port() + "/", "www.example.com:" + u.Port() + "/page", "www.example.com:" + u.Port() + "/missing"},
+			errors:   []string{"https://www.example.com/missing"},
+		},
+		{
+			name:     "rewrite",
+			cfg:      conf.Config{HTTP: conf.HTTP{Rewrite: []string{"https://www.example.com " + ts.URL}}},
+			sched:    conf.ScheduleData{URL: []string{"https://www.example.com/"}},
+			requests: []string{u.Host + "/", u.Host + "/page", u.Host + "/missing"},
+			errors:   []string{"https://www.example.com/missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckHTTP(&tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			if err := CheckOverrides(tt.sched); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+			sched := tt.sched
+			sched.Depth, sched.IgnoreRobots = 2, true
+			s := runScan(t, &tt.cfg, nil, sched)
+
+			mu.Lock()
+			if !reflect.DeepEqual(requests, tt.requests) {
+				t.Errorf("Requests:\r\nполучено: %v\r\nожидается: %v", requests, tt.requests)
+			}
+			mu.Unlock()
+			var errs []string
+			for link := range s.Errors {
+				errs = append(errs, link)
+			}
+			if !reflect.DeepEqual(errs, tt.errors) {
+				t.Errorf("Errors: получено %v, ожидается %v", errs, tt.errors)
+			}
+		})
+	}
+
+	for _, entry := range []string{"www.example.com:127.0.0.1", "www.example.com:http:127.0.0.1"} {
+		if err := CheckOverrides(conf.ScheduleData{Resolve: []string{entry}}); err == nil {
+			t.Errorf("Resolve %q is accepted", entry)
+		}
+	}
+	if _, ok := (rewriteRule{from: "https://www.example.com", to: "http://staging"}).apply("https://www.example.com.evil/"); ok {
+		t.Error("Rewrite prefix matched inside the host name")
+	}
+}
+
+func TestService_rewriteReport(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+		case "/":
+			if _, err := r.Cookie("sid"); err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="https://www.example.com/old">old</a>`)
+		case "/old":
+			// Тестовый сервер перенаправляет на свой собственный адрес
+			http.Redirect(w, r, ts.URL+"/page", http.StatusMovedPermanently)
+		case "/page":
+			fmt.Fprint(w, "page")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	os.Setenv("BLC_TEST_PASSWORD", "secret")
+	defer os.Unsetenv("BLC_TEST_PASSWORD")
+
+	cfg := conf.Config{
+		HTTP: conf.HTTP{Rewrite: []string{"https://www.example.com " + ts.URL}},
+		Credentials: map[string]*conf.Credentials{"form": {
+			Type:     AuthForm,
+			LoginURL: "https://www.example.com/login",
+			Username: "checker",
+			Password: "${env:BLC_TEST_PASSWORD}",
+		}},
+	}
+	if err := CheckHTTP(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCredentials(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	s := runScan(t, &cfg, nil, conf.ScheduleData{
+		URL: []string{"https://www.example.com/"}, Depth: 2, IgnoreRobots: true, Soft404: true, Credentials: []string{"form"},
+	})
+
+	// Вход и проверка случайного адреса тоже идут на тестовый сервер
+	mu.Lock()
+	var login, probe bool
+	for _, r := range requests {
+		switch r {
+		case "POST /login":
+			login = true
+		case "GET /", "GET /old", "GET /page":
+		default:
+			probe = true
+		}
+	}
+	mu.Unlock()
+	if !login || !probe {
+		t.Errorf("Requests: %v", requests)
+	}
+
+	var found bool
+	for _, f := range s.Findings {
+		if f.Category == FindingPermanentRedirect && f.URL == "https://www.example.com/old" {
+			found = true
+			if f.FinalURL != "https://www.example.com/page" {
+				t.Errorf("FinalURL: %s", f.FinalURL)
+			}
+		}
+		report := fmt.Sprint(f)
+		if strings.Contains(report, ts.URL) {
+			t.Errorf("Finding contains the rewritten URL: %s", report)
+		}
+	}
+	if !found {
+		t.Errorf("Findings: %v", s.Findings)
+	}
+	for link := range s.Processed {
+		if strings.Contains(link, ts.URL) {
+			t.Errorf("Processed contains the rewritten URL: %s", link)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"blc/pkg/conf"
+)
+
+// Параметры перенаправлений по умолчанию
+const (
+	// Максимальное количество перенаправлений, которые выполняет клиент
+	defaultMaxRedirects = 10
+	// Цепочки из этого количества перенаправлений и длиннее попадают в отчет
+	defaultLongRedirectChain = 3
+)
+
+// errRedirectLoop возвращается клиентом, если перенаправление ведет на уже пройденный URL
+var errRedirectLoop = errors.New("redirect loop")
+
+// Redirect это один шаг цепочки перенаправлений: URL и код ответа, с которым он перенаправил дальше
+type Redirect struct {
+	URL        string
+	HTTPStatus int
+}
+
+// redirectPolicy описывает, о каких перенаправлениях сообщать в отчете
+type redirectPolicy struct {
+	maxRedirects      int
+	longChain         int
+	ignorePermanent   bool
+	ignoreCrossDomain bool
+}
+
+// newRedirectPolicy возвращает настройки перенаправлений из конфигурации
+func newRedirectPolicy(cfg conf.Crawler) redirectPolicy {
+	p := redirectPolicy{
+		maxRedirects:      cfg.MaxRedirects,
+		longChain:         cfg.LongRedirectChain,
+		ignorePermanent:   cfg.IgnorePermanentRedirects,
+		ignoreCrossDomain: cfg.IgnoreCrossDomainRedirects,
+	}
+	if p.maxRedirects <= 0 {
+		p.maxRedirects = defaultMaxRedirects
+	}
+	if p.longChain <= 0 {
+		p.longChain = defaultLongRedirectChain
+	}
+	return p
+}
+
+// checkRedirect прерывает перенаправления при зацикливании и при превышении их количества
+func (p redirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	for _, r := range via {
+		if r.URL.String() == req.URL.String() {
+			return errRedirectLoop
+		}
+	}
+	if len(via) >= p.maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", p.maxRedirects)
+	}
+	return nil
+}
+
+// redirectChain возвращает цепочку перенаправлений, которая привела к ответу response
+func redirectChain(response *http.Response) []Redirect {
+	chain := make([]Redirect, 0)
+	for r := response.Request.Response; r != nil; r = r.Request.Response {
+		chain = append([]Redirect{{URL: r.Request.URL.String(), HTTPStatus: r.StatusCode}}, chain...)
+	}
+	return chain
+}
+
+// formatChain возвращает цепочку перенаправлений в виде строки "A (301) -> B (302) -> C"
+func formatChain(chain []Redirect, final string) string {
+	var b strings.Builder
+	for _, r := range chain {
+		fmt.Fprintf(&b, "%s (%d) -> ", r.URL, r.HTTPStatus)
+	}
+	b.WriteString(final)
+	return b.String()
+}
+
+// sameSite сравнивает хосты без учета префикса "www."
+func sameSite(a, b *url.URL) bool {
+	return strings.TrimPrefix(strings.ToLower(a.Hostname()), "www.") == strings.TrimPrefix(strings.ToLower(b.Hostname()), "www.")
+}
+
+// redirectFindings добавляет замечания по цепочке перенаправлений ссылки t
+func (s *Service) redirectFindings(t task, chain []Redirect, final string, status int) {
+	if len(chain) == 0 {
+		return
+	}
+	path := formatChain(chain, final)
+	add := func(category, message string) {
+		s.addFinding(Finding{Category: category, URL: t.link, HTTPStatus: status, Message: message, ParentURL: t.baseLink, FinalURL: final, Redirects: chain})
+	}
+
+	if len(chain) >= s.redirects.longChain {
+		add(FindingRedirectChain, fmt.Sprintf("%d redirects: %s", len(chain), path))
+	}
+	if !s.redirects.ignorePermanent {
+		if code := chain[0].HTTPStatus; code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect {
+			add(FindingPermanentRedirect, fmt.Sprintf("Permanently moved (%d), update the link to %s", code, final))
+		}
+	}
+	prev, err := url.Parse(chain[0].URL)
+	if err != nil {
+		return
+	}
+	first := prev
+	for i := 1; i <= len(chain); i++ {
+		next := final
+		if i < len(chain) {
+			next = chain[i].URL
+		}
+		u, err := url.Parse(next)
+		if err != nil {
+			return
+		}
+		if prev.Scheme == "https" && u.Scheme == "http" {
+			add(FindingRedirectDowngrade, "Redirect from HTTPS to HTTP: "+path)
+			break
+		}
+		prev = u
+	}
+	if last, err := url.Parse(final); err == nil && !s.redirects.ignoreCrossDomain && !sameSite(first, last) {
+		add(FindingCrossDomainRedirect, "Redirect to another domain: "+path)
+	}
+}
+
+// withRedirects дополняет описание ошибки конечным URL и цепочкой перенаправлений
+func withRedirects(e ErrorResult, response *http.Response) ErrorResult {
+	if chain := redirectChain(response); len(chain) > 0 {
+		e.Redirects = chain
+		e.FinalURL = response.Request.URL.String()
+	}
+	return e
+}
@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_redirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/chain1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/chain2", http.StatusFound)
+	})
+	mux.HandleFunc("/chain2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/chain3", http.StatusFound)
+	})
+	mux.HandleFunc("/chain3", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target.html", http.StatusFound)
+	})
+	mux.HandleFunc("/old.html", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/target.html", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/loop1", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop2", http.StatusFound)
+	})
+	mux.HandleFunc("/loop2", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop1", http.StatusFound)
+	})
+	mux.HandleFunc("/target.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `target`)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/chain1">chain</a><a href="/old.html">old</a><a href="/loop1">loop</a>`)
+	})
+	s := runScan(t, nil, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1})
+
+	got := make([]string, 0)
+	for _, f := range s.Findings {
+		got = append(got, fmt.Sprintf("%s %s %s %d", f.Category, f.URL, f.FinalURL, len(f.Redirects)))
+	}
+	sort.Strings(got)
+	want := []string{
+		FindingRedirectChain + " " + s.URL + "/chain1 " + s.URL + "/target.html 3",
+		FindingPermanentRedirect + " " + s.URL + "/old.html " + s.URL + "/target.html 1",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Findings:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+
+	if e, ok := s.Errors[s.URL+"/loop1"]; !ok || e.Type != ErrorTypeRedirectLoop {
+		t.Errorf("Ошибка для %s: получено %+v, ожидается тип %q", s.URL+"/loop1", e, ErrorTypeRedirectLoop)
+	}
+}
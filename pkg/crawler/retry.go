@@ -0,0 +1,254 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+// Классы ошибок, после которых запрос можно повторить
+const (
+	// RetryDNS - ошибка разрешения имени хоста
+	RetryDNS = "dns"
+	// RetryReset - соединение разорвано сервером
+	RetryReset = "reset"
+	// RetryTimeout - истекло время ожидания ответа
+	RetryTimeout = "timeout"
+	// Retry5xx - ошибка сервера
+	Retry5xx = "5xx"
+	// Retry429 - превышено количество запросов
+	Retry429 = "429"
+)
+
+// Параметры повторов по умолчанию
+const (
+	// Максимальное количество попыток запроса, включая первую
+	defaultRetryAttempts = 3
+	// Пауза перед первым повтором, удваивается с каждой попыткой
+	defaultRetryBackoff = 500 * time.Millisecond
+	// Максимальная пауза между попытками
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+// Attempt описывает одну попытку запроса
+type Attempt struct {
+	Method     string
+	HTTPStatus int
+	Error      string
+	// Класс ошибки, если попытка завершилась ошибкой, после которой запрос можно повторить
+	Class string
+}
+
+// retryLimits задает количество попыток и паузы между ними
+type retryLimits struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// retryPolicy определяет, какие ошибки повторять, сколько раз и с какими паузами
+type retryPolicy struct {
+	classes map[string]bool
+	// Параметры повторов по классам ошибок (секции Retry), для остальных классов - общие
+	limits map[string]retryLimits
+	retryLimits
+}
+
+// newRetryPolicy возвращает политику повторов из секции Crawler и секций Retry классов ошибок.
+// Если классы ошибок не заданы, повторяются все
+func newRetryPolicy(cfg conf.Crawler, classes map[string]*conf.Retry) retryPolicy {
+	p := retryPolicy{
+		classes: make(map[string]bool),
+		limits:  make(map[string]retryLimits),
+		retryLimits: retryLimits{
+			attempts:   cfg.RetryAttempts,
+			backoff:    time.Duration(cfg.RetryBackoff) * time.Millisecond,
+			maxBackoff: time.Duration(cfg.RetryMaxBackoff) * time.Millisecond,
+		},
+	}
+	on := cfg.RetryOn
+	if len(on) == 0 {
+		on = []string{RetryDNS, RetryReset, RetryTimeout, Retry5xx, Retry429}
+	}
+	for _, c := range on {
+		p.classes[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+	if p.attempts <= 0 {
+		p.attempts = defaultRetryAttempts
+	}
+	if p.backoff <= 0 {
+		p.backoff = defaultRetryBackoff
+	}
+	if p.maxBackoff <= 0 {
+		p.maxBackoff = defaultRetryMaxBackoff
+	}
+	for class, r := range classes {
+		l := p.retryLimits
+		if r.Attempts > 0 {
+			l.attempts = r.Attempts
+		}
+		if r.Backoff > 0 {
+			l.backoff = time.Duration(r.Backoff) * time.Millisecond
+		}
+		if r.MaxBackoff > 0 {
+			l.maxBackoff = time.Duration(r.MaxBackoff) * time.Millisecond
+		}
+		p.limits[strings.ToLower(class)] = l
+	}
+	return p
+}
+
+// CheckRetryClasses проверяет классы ошибок для повторов и секции Retry из конфигурации
+func CheckRetryClasses(cfg *conf.Config) error {
+	for _, c := range cfg.Crawler.RetryOn {
+		if !retryClassValid(strings.TrimSpace(c)) {
+			return fmt.Errorf("unknown retry class %q", c)
+		}
+	}
+	for class := range cfg.Retry {
+		if !retryClassValid(class) {
+			return fmt.Errorf("unknown retry class %q in Retry section", class)
+		}
+	}
+	return nil
+}
+
+// retryClassValid проверяет имя класса ошибок
+func retryClassValid(class string) bool {
+	switch strings.ToLower(class) {
+	case RetryDNS, RetryReset, RetryTimeout, Retry5xx, Retry429:
+		return true
+	}
+	return false
+}
+
+// limit возвращает параметры повторов для класса ошибок class
+func (p retryPolicy) limit(class string) retryLimits {
+	if l, ok := p.limits[class]; ok {
+		return l
+	}
+	return p.retryLimits
+}
+
+// delay возвращает паузу перед повтором после попытки attempt: экспоненциальный рост
+// со случайной составляющей, чтобы обработчики не повторяли запросы одновременно
+func (l retryLimits) delay(attempt int) time.Duration {
+	d := l.backoff
+	for i := 1; i < attempt && d < l.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > l.maxBackoff {
+		d = l.maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryClass возвращает класс ошибки запроса или пустую строку, если ошибка не временная
+func retryClass(response *http.Response, err error) string {
+	if err != nil {
+		var dnsErr *net.DNSError
+		var netErr net.Error
+		switch {
+		case errors.Is(err, errRedirectLoop):
+			return ""
+		case errors.As(err, &dnsErr):
+			return RetryDNS
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			return RetryTimeout
+		case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return RetryReset
+		}
+		return ""
+	}
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+		return Retry429
+	case response.StatusCode >= 500 && response.StatusCode <= 599:
+		return Retry5xx
+	}
+	return ""
+}
+
+// summary возвращает описание попыток последнего метода запроса для отчетов: "failed 3/3 attempts"
+// (из допустимого для класса последней ошибки количества) или "recovered on retry 2".
+// Для ссылок, проверенных с первой попытки, возвращает пустую строку
+func (p retryPolicy) summary(attempts []Attempt, failed bool) string {
+	attempts = lastMethodAttempts(attempts)
+	switch {
+	case failed && len(attempts) > 0 && p.classes[attempts[len(attempts)-1].Class]:
+		allowed := p.limit(attempts[len(attempts)-1].Class).attempts
+		if allowed < len(attempts) {
+			// Предыдущие попытки завершились ошибками класса, для которого допустимо больше попыток
+			allowed = len(attempts)
+		}
+		return fmt.Sprintf("failed %d/%d attempts", len(attempts), allowed)
+	case !failed && len(attempts) > 1:
+		return fmt.Sprintf("recovered on retry %d", len(attempts)-1)
+	}
+	return ""
+}
+
+// do выполняет запрос, повторяя его после временных ошибок по политике повторов.
+// Паузы между попытками выдерживаются для всего хоста: ответ с Retry-After задает паузу явно,
+// если она больше допустимой, запрос не повторяется. Retry-After откладывает запросы к хосту (не больше
+// допустимой паузы), даже если запрос не повторяется. Возвращает ответ последней попытки и историю попыток.
+// Место хоста в ограничителе для первой попытки занимает вызывающий код. На время паузы перед повтором
+// место освобождается, после выполнения место остается занятым, освобождать его должен вызывающий код
+func (s *Service) do(client *http.Client, request *http.Request, host string) (*http.Response, []Attempt, error) {
+	attempts := make([]Attempt, 0, 1)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			s.limiter.acquire(host)
+		}
+		if client.Jar != nil {
+			// Клиент добавляет cookie из хранилища в сам запрос, при повторе они добавились бы еще раз
+			request.Header.Del("Cookie")
+		}
+		response, err := client.Do(request)
+		a := Attempt{Method: request.Method, Class: retryClass(response, err)}
+		if err != nil {
+			a.Error = err.Error()
+		} else {
+			a.HTTPStatus = response.StatusCode
+			a.Error = response.Status
+		}
+		attempts = append(attempts, a)
+		var after time.Duration
+		var hasAfter bool
+		if response != nil {
+			if after, hasAfter = s.limiter.retryAfter(response); hasAfter {
+				if after > s.limiter.maxRetryAfter {
+					s.limiter.block(host, s.limiter.maxRetryAfter)
+				} else {
+					s.limiter.block(host, after)
+				}
+			}
+		}
+		limit := s.retries.limit(a.Class)
+		if a.Class == "" || !s.retries.classes[a.Class] || attempt >= limit.attempts || s.state() == STOPPED {
+			return response, attempts, err
+		}
+		d := limit.delay(attempt)
+		if hasAfter {
+			if after > s.limiter.maxRetryAfter {
+				return response, attempts, nil
+			}
+			d = after
+		}
+		if response != nil {
+			response.Body.Close()
+		}
+		s.limiter.release(host)
+		s.limiter.block(host, d)
+		s.logger.Info(fmt.Sprintf("%s: %s, retry %d in %v", request.URL, a.Error, attempt, d))
+	}
+}
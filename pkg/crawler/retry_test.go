@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+func TestService_retries(t *testing.T) {
+	var flakyRequests, brokenRequests, missingRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flakyRequests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&brokenRequests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&missingRequests, 1)
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/flaky">1</a><a href="/broken">2</a><a href="/missing">3</a>`)
+	})
+
+	cfg := &conf.Config{Crawler: conf.Crawler{RetryOn: []string{Retry5xx}, RetryAttempts: 3, RetryBackoff: 10, RetryMaxBackoff: 20}}
+	s := runScan(t, cfg, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1})
+
+	if e := s.Errors[s.URL+"/broken"]; e.Retry != "failed 3/3 attempts" || len(e.Attempts) != 3 {
+		t.Errorf("/broken: получено %q, %d попыток, ожидается \"failed 3/3 attempts\"", e.Retry, len(e.Attempts))
+	}
+	if e := s.Errors[s.URL+"/missing"]; e.Retry != "" || len(e.Attempts) != 1 {
+		t.Errorf("/missing: получено %q, %d попыток, ожидается 1 попытка", e.Retry, len(e.Attempts))
+	}
+	if _, ok := s.Errors[s.URL+"/flaky"]; ok {
+		t.Errorf("/flaky: ожидается рабочая ссылка")
+	}
+	found := false
+	for _, f := range s.Findings {
+		if f.Category == FindingFlaky && f.URL == s.URL+"/flaky" {
+			found = strings.HasPrefix(f.Message, "Recovered on retry 2")
+		}
+	}
+	if !found {
+		t.Errorf("Findings: получено %v, ожидается %q для /flaky", s.Findings, FindingFlaky)
+	}
+	requests := []int32{atomic.LoadInt32(&flakyRequests), atomic.LoadInt32(&brokenRequests), atomic.LoadInt32(&missingRequests)}
+	if !reflect.DeepEqual(requests, []int32{3, 3, 1}) {
+		t.Errorf("Requests: получено: %v, ожидается: [3 3 1]", requests)
+	}
+
+	p := newRetryPolicy(conf.Crawler{RetryBackoff: 100, RetryMaxBackoff: 300}, nil)
+	for attempt, max := range []time.Duration{100, 200, 300, 300} {
+		max *= time.Millisecond
+		if d := p.delay(attempt + 1); d < max/2 || d > max {
+			t.Errorf("delay(%d) = %v, ожидается от %v до %v", attempt+1, d, max/2, max)
+		}
+	}
+}
+
+func TestService_retryClasses(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/broken">broken</a><a href="/busy">busy</a>`)
+		case "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	cfg := &conf.Config{
+		Crawler: conf.Crawler{RetryAttempts: 4, RetryBackoff: 10, RetryMaxBackoff: 20},
+		Retry:   map[string]*conf.Retry{"5xx": {Attempts: 2}},
+	}
+	if err := CheckRetryClasses(cfg); err != nil {
+		t.Fatal(err)
+	}
+	s := runScan(t, cfg, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1, IgnoreRobots: true})
+
+	// Для 5xx действует количество попыток из секции Retry, для 429 - общее
+	for path, want := range map[string]string{"/broken": "failed 2/2 attempts", "/busy": "failed 4/4 attempts"} {
+		if e := s.Errors[s.URL+path]; e.Retry != want {
+			t.Errorf("%s: получено %q, ожидается %q", path, e.Retry, want)
+		}
+	}
+	mu.Lock()
+	if requests["/broken"] != 2 || requests["/busy"] != 4 {
+		t.Errorf("Requests: %v", requests)
+	}
+	mu.Unlock()
+
+	if err := CheckRetryClasses(&conf.Config{Retry: map[string]*conf.Retry{"4xx": {}}}); err == nil {
+		t.Error("Retry section of an unknown class is accepted")
+	}
+}
+
+func TestService_retryAfterNoRetry(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]time.Time)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = time.Now()
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/busy">busy</a><a href="/next">next</a>`)
+		case "/busy":
+			// 429 не повторяется, но пауза из Retry-After действует на весь хост
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	})
+	cfg := &conf.Config{Crawler: conf.Crawler{Workers: 1, RetryOn: []string{Retry5xx}}}
+	s := runScan(t, cfg, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1, IgnoreRobots: true})
+
+	if e := s.Errors[s.URL+"/busy"]; len(e.Attempts) != 1 {
+		t.Errorf("/busy: получено %d попыток, ожидается 1", len(e.Attempts))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if d := requested["/next"].Sub(requested["/busy"]); d < 900*time.Millisecond {
+		t.Errorf("Retry-After не выдержан: следующий запрос через %v", d)
+	}
+}
@@ -0,0 +1,273 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Токен User-agent по умолчанию для поиска правил в robots.txt
+const defaultRobotsUserAgent = "blc"
+
+// Максимальный размер robots.txt, который будет прочитан
+const maxRobotsSize = 512 * 1024
+
+// robotsRule это одно правило Allow/Disallow
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// robotsGroup это группа правил для одного или нескольких User-agent
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsRules это правила robots.txt, применимые к нашему User-agent
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	// Ссылки на sitemap из директив Sitemap (не зависят от User-agent)
+	sitemaps []string
+}
+
+// robotsEntry это элемент кэша robots.txt, загружается один раз
+type robotsEntry struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+// robots загружает и кэширует robots.txt для каждого хоста
+type robots struct {
+	userAgent string
+	entries   map[string]*robotsEntry
+	mux       sync.Mutex
+}
+
+// newRobots создает кэш robots.txt для указанного токена User-agent
+func newRobots(userAgent string) *robots {
+	var r robots
+	r.userAgent = productToken(userAgent)
+	if r.userAgent == "" {
+		r.userAgent = defaultRobotsUserAgent
+	}
+	r.entries = make(map[string]*robotsEntry)
+	return &r
+}
+
+// rules возвращает правила robots.txt для хоста ссылки u, при первом обращении загружает их функцией fetch
+func (r *robots) rules(u *url.URL, fetch func(string) (*http.Response, error)) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+	r.mux.Lock()
+	e, ok := r.entries[key]
+	if !ok {
+		e = &robotsEntry{}
+		r.entries[key] = e
+	}
+	r.mux.Unlock()
+
+	e.once.Do(func() {
+		e.rules = &robotsRules{}
+		response, err := fetch(key + "/robots.txt")
+		if err != nil {
+			// robots.txt недоступен - сканировать можно все
+			return
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return
+		}
+		e.rules = parseRobots(io.LimitReader(response.Body, maxRobotsSize), r.userAgent)
+	})
+	return e.rules
+}
+
+// productToken возвращает токен продукта из значения User-agent в нижнем регистре: начало значения
+// из латинских букв, "_" и "-" (RFC 9309), например "blc" для "BLC/1.0"
+func productToken(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	end := strings.IndexFunc(value, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r == '_' || r == '-')
+	})
+	if end >= 0 {
+		value = value[:end]
+	}
+	return value
+}
+
+// parseRobots разбирает robots.txt и возвращает правила группы, подходящей для userAgent.
+// Группа подходит, если ее токен совпадает с userAgent целиком без учета регистра (RFC 9309),
+// иначе используется группа "*". Правила нескольких подходящих групп объединяются
+func parseRobots(body io.Reader, userAgent string) *robotsRules {
+	groups := make([]*robotsGroup, 0)
+	sitemaps := make([]string, 0)
+	var current *robotsGroup
+	// Строки User-agent подряд относятся к одной группе
+	agentsOpen := false
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			if !agentsOpen {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+				agentsOpen = true
+			}
+			if value == "*" {
+				current.agents = append(current.agents, value)
+			} else {
+				current.agents = append(current.agents, productToken(value))
+			}
+		case "allow", "disallow":
+			agentsOpen = false
+			if current == nil {
+				continue
+			}
+			if value == "" {
+				// Пустой Disallow разрешает все
+				continue
+			}
+			current.rules = append(current.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			agentsOpen = false
+			if current == nil {
+				continue
+			}
+			if sec, err := strconv.ParseFloat(value, 64); err == nil && sec > 0 {
+				current.crawlDelay = time.Duration(sec * float64(time.Second))
+			}
+		case "sitemap":
+			if value != "" {
+				sitemaps = append(sitemaps, value)
+			}
+		}
+	}
+
+	var matched, global []*robotsGroup
+	for _, g := range groups {
+		if g.has(userAgent) {
+			matched = append(matched, g)
+		} else if g.has("*") {
+			global = append(global, g)
+		}
+	}
+	if len(matched) == 0 {
+		matched = global
+	}
+	rules := &robotsRules{sitemaps: sitemaps}
+	for _, g := range matched {
+		rules.rules = append(rules.rules, g.rules...)
+		if rules.crawlDelay == 0 {
+			rules.crawlDelay = g.crawlDelay
+		}
+	}
+	return rules
+}
+
+// has проверяет, относится ли группа к токену agent
+func (g *robotsGroup) has(agent string) bool {
+	for _, a := range g.agents {
+		if a != "" && a == agent {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed проверяет, разрешено ли сканировать путь ссылки u.
+// Применяется правило с самым длинным шаблоном, при равной длине Allow имеет приоритет
+func (r *robotsRules) allowed(u *url.URL) bool {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	allow := true
+	matched := -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.pattern, p) {
+			continue
+		}
+		l := len(rule.pattern)
+		if l > matched || (l == matched && rule.allow) {
+			allow = rule.allow
+			matched = l
+		}
+	}
+	return allow
+}
+
+// robotsMatch проверяет соответствие пути шаблону robots.txt: "*" - любая последовательность символов,
+// "$" в конце - конец пути
+func robotsMatch(pattern, p string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(p, parts[0]) {
+		return false
+	}
+	rest := p[len(parts[0]):]
+	for i := 1; i < len(parts); i++ {
+		if i == len(parts)-1 && anchored {
+			return strings.HasSuffix(rest, parts[i])
+		}
+		j := strings.Index(rest, parts[i])
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(parts[i]):]
+	}
+	return !anchored || rest == ""
+}
+
+// robotsAllowed проверяет ссылку по robots.txt ее хоста и применяет Crawl-delay к ограничителю нагрузки
+func (s *Service) robotsAllowed(u *url.URL) bool {
+	rules := s.robotsRules(u)
+	if rules.crawlDelay > 0 {
+		s.limiter.slowDown(u.Hostname(), rules.crawlDelay)
+	}
+	return rules.allowed(u)
+}
+
+// robotsRules возвращает правила robots.txt для хоста ссылки u
+func (s *Service) robotsRules(u *url.URL) *robotsRules {
+	return s.robots.rules(u, func(robotsURL string) (*http.Response, error) {
+		request, err := http.NewRequest("GET", robotsURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Add("User-Agent", userAgent)
+		s.authorize(request)
+		s.limiter.acquire(u.Hostname())
+		defer s.limiter.release(u.Hostname())
+		response, _, err := s.do(s.client, request, u.Hostname())
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("robots.txt: %v", err))
+			return nil, err
+		}
+		return response, nil
+	})
+}
@@ -0,0 +1,85 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+func TestService_robots(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /\n\nUser-agent: blc\nDisallow: /private/\nAllow: /private/open.html$\nCrawl-delay: 0.2\n")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/private/secret.html">secret</a><a href="/private/open.html">open</a><a href="/public.html">public</a>`)
+	})
+
+	started := time.Now()
+	s := runScan(t, &conf.Config{Crawler: conf.Crawler{Workers: 3}}, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1})
+
+	want := map[string]SkipResult{
+		s.URL + "/private/secret.html": {Reason: SkippedByRobots, ParentURL: s.URL + "/"},
+	}
+	if !reflect.DeepEqual(s.Skipped, want) {
+		t.Errorf("Skipped:\r\nполучено: %v\r\nожидается: %v", s.Skipped, want)
+	}
+	if _, ok := s.Processed[s.URL+"/private/open.html"]; !ok {
+		t.Errorf("Processed: нет разрешенной ссылки %s", s.URL+"/private/open.html")
+	}
+	// 3 страницы с Crawl-delay 0.2 сек
+	if elapsed := time.Since(started); elapsed < 400*time.Millisecond {
+		t.Errorf("Crawl-delay не выдержан: %v", elapsed)
+	}
+}
+
+func Test_parseRobots(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		// Пути, разрешенные и запрещенные для токена blc
+		allowed    []string
+		disallowed []string
+	}{
+		{
+			name:       "token is matched case-insensitively without version",
+			robots:     "User-agent: *\nDisallow: /\n\nUser-agent: BLC/2.0\nDisallow: /private/\n",
+			allowed:    []string{"/page.html"},
+			disallowed: []string{"/private/page.html"},
+		},
+		{
+			name:       "token is not matched by substring",
+			robots:     "User-agent: bl\nUser-agent: blc-extra\nDisallow: /\n\nUser-agent: *\nDisallow: /tmp/\n",
+			allowed:    []string{"/page.html"},
+			disallowed: []string{"/tmp/page.html"},
+		},
+		{
+			name:       "matching groups are combined",
+			robots:     "User-agent: blc\nDisallow: /a/\n\nUser-agent: *\nDisallow: /\n\nUser-agent: blc\nDisallow: /b/\n",
+			allowed:    []string{"/page.html"},
+			disallowed: []string{"/a/page.html", "/b/page.html"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(tt.robots), productToken("blc"))
+			for _, p := range tt.allowed {
+				if !rules.allowed(&url.URL{Path: p}) {
+					t.Errorf("%s запрещен", p)
+				}
+			}
+			for _, p := range tt.disallowed {
+				if rules.allowed(&url.URL{Path: p}) {
+					t.Errorf("%s разрешен", p)
+				}
+			}
+		})
+	}
+}
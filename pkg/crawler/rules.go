@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"blc/pkg/conf"
+)
+
+// Результаты классификации ссылок
+const (
+	// OutcomeOK - ссылка рабочая
+	OutcomeOK = "ok"
+	// OutcomeWarning - ссылка рабочая, но попадает в отчет как замечание
+	OutcomeWarning = "warning"
+	// OutcomeBroken - ссылка битая
+	OutcomeBroken = "broken"
+	// OutcomeIgnored - ссылка не проверяется и не попадает в список ошибок
+	OutcomeIgnored = "ignored"
+)
+
+// Количество ошибок, после превышения которого сканирование прерывается (если бюджет не задан)
+const defaultMaxErrors = 35
+
+// statusRange это диапазон кодов ответа
+type statusRange struct {
+	from int
+	to   int
+}
+
+// headerMatch это условие на заголовок ответа. Пустое значение означает, что заголовок должен присутствовать
+type headerMatch struct {
+	name  string
+	value string
+}
+
+// rule это правило классификации ссылок
+type rule struct {
+	name     string
+	order    int
+	statuses []statusRange
+	headers  []headerMatch
+	hosts    []string
+	urls     []*regexp.Regexp
+	outcome  string
+	message  string
+}
+
+// Правила по умолчанию, проверяются после правил из конфигурации.
+// Ссылки, не подпадающие ни под одно правило, считаются рабочими
+var defaultRules = []rule{
+	{
+		name:     "cloudflare",
+		statuses: []statusRange{{403, 403}},
+		headers:  []headerMatch{{"Cf-Chl-Bypass", "1"}},
+		outcome:  OutcomeBroken,
+		message:  "Protected by CloudFlare CAPTCHA",
+	},
+	// 418 отдают некоторые сайты в ответ на запросы роботов
+	{name: "teapot", statuses: []statusRange{{418, 418}}, outcome: OutcomeOK},
+	{name: "network error", statuses: []statusRange{{0, 0}}, outcome: OutcomeBroken},
+	{name: "http error", statuses: []statusRange{{400, 999}}, outcome: OutcomeBroken},
+}
+
+// CheckRules проверяет правила классификации ссылок из конфигурации
+func CheckRules(cfg *conf.Config) error {
+	_, err := compileRules(cfg.Rule)
+	return err
+}
+
+// compileRules возвращает правила из конфигурации в порядке проверки, дополненные правилами по умолчанию
+func compileRules(cfg map[string]*conf.Rule) ([]rule, error) {
+	rules := make([]rule, 0, len(cfg)+len(defaultRules))
+	for name, r := range cfg {
+		compiled, err := compileRule(name, r)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", name, err)
+		}
+		rules = append(rules, compiled)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].order != rules[j].order {
+			return rules[i].order < rules[j].order
+		}
+		return rules[i].name < rules[j].name
+	})
+	return append(rules, defaultRules...), nil
+}
+
+// compileRule разбирает условия правила
+func compileRule(name string, cfg *conf.Rule) (rule, error) {
+	r := rule{name: name, order: cfg.Order, message: cfg.Message}
+	r.outcome = strings.ToLower(strings.TrimSpace(cfg.Outcome))
+	switch r.outcome {
+	case OutcomeOK, OutcomeWarning, OutcomeBroken, OutcomeIgnored:
+	default:
+		return r, fmt.Errorf("unknown outcome %q", cfg.Outcome)
+	}
+	for _, st := range cfg.Status {
+		sr, err := parseStatusRange(st)
+		if err != nil {
+			return r, err
+		}
+		r.statuses = append(r.statuses, sr)
+	}
+	for _, h := range cfg.Header {
+		var hm headerMatch
+		if i := strings.Index(h, ":"); i >= 0 {
+			hm = headerMatch{name: strings.TrimSpace(h[:i]), value: strings.TrimSpace(h[i+1:])}
+		} else {
+			hm = headerMatch{name: strings.TrimSpace(h)}
+		}
+		if hm.name == "" {
+			return r, fmt.Errorf("empty header name in %q", h)
+		}
+		r.headers = append(r.headers, hm)
+	}
+	for _, h := range cfg.Host {
+		r.hosts = append(r.hosts, strings.ToLower(strings.TrimSpace(h)))
+	}
+	for _, u := range cfg.URL {
+		re, err := regexp.Compile(u)
+		if err != nil {
+			return r, fmt.Errorf("URL pattern %q: %v", u, err)
+		}
+		r.urls = append(r.urls, re)
+	}
+	return r, nil
+}
+
+// parseStatusRange разбирает код ответа ("404") или диапазон кодов ("500-599")
+func parseStatusRange(value string) (statusRange, error) {
+	parts := strings.SplitN(value, "-", 2)
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid status %q", value)
+	}
+	to := from
+	if len(parts) == 2 {
+		if to, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil || to < from {
+			return statusRange{}, fmt.Errorf("invalid status range %q", value)
+		}
+	}
+	return statusRange{from: from, to: to}, nil
+}
+
+// beforeRequest проверяет, что правило не зависит от ответа и может быть применено до запроса
+func (r rule) beforeRequest() bool {
+	return len(r.statuses) == 0 && len(r.headers) == 0
+}
+
+// matchLink проверяет условия правила на хост и URL ссылки
+func (r rule) matchLink(u *url.URL) bool {
+	if len(r.hosts) > 0 && !matchHost(u, r.hosts) {
+		return false
+	}
+	if len(r.urls) > 0 {
+		link := u.String()
+		found := false
+		for _, re := range r.urls {
+			if re.MatchString(link) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHost проверяет, подходит ли хост URL под один из шаблонов: имя хоста или "*.example.com" (домен и поддомены)
+func matchHost(u *url.URL, hosts []string) bool {
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		if host == h || (strings.HasPrefix(h, "*.") && (host == h[2:] || strings.HasSuffix(host, h[1:]))) {
+			return true
+		}
+	}
+	return false
+}
+
+// match проверяет все условия правила. Для сетевых ошибок status равен 0, header - nil
+func (r rule) match(u *url.URL, status int, header http.Header) bool {
+	if len(r.statuses) > 0 {
+		found := false
+		for _, sr := range r.statuses {
+			if status >= sr.from && status <= sr.to {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, hm := range r.headers {
+		values, ok := header[http.CanonicalHeaderKey(hm.name)]
+		if !ok {
+			return false
+		}
+		if hm.value == "" {
+			continue
+		}
+		found := false
+		for _, v := range values {
+			if strings.EqualFold(strings.TrimSpace(v), hm.value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.matchLink(u)
+}
+
+// ignoredRule возвращает правило, по которому ссылка игнорируется без запроса
+func (s *Service) ignoredRule(u *url.URL) (rule, bool) {
+	for _, r := range s.rules {
+		if r.beforeRequest() && r.matchLink(u) {
+			return r, r.outcome == OutcomeIgnored
+		}
+	}
+	return rule{}, false
+}
+
+// applyRule применяет к ссылке t результат классификации r. e - описание ошибки на случай, если ссылка битая.
+// Возвращает true, если ссылка рабочая и ее обработку нужно продолжить
+func (s *Service) applyRule(t task, r rule, e ErrorResult) bool {
+	if r.message != "" {
+		e.Error = r.message
+	}
+	switch r.outcome {
+	case OutcomeBroken:
+		s.addError(t.link, e)
+		return false
+	case OutcomeIgnored:
+		s.mux.Lock()
+		delete(s.Errors, t.link)
+		s.mux.Unlock()
+		s.skip(t.link, SkipResult{Reason: SkippedByRule + ": " + r.name, ParentURL: t.baseLink})
+		return false
+	case OutcomeWarning:
+		s.addFinding(Finding{Category: FindingWarning, URL: t.link, HTTPStatus: e.HTTPStatus, Message: e.Error, ParentURL: t.baseLink, FinalURL: e.FinalURL, Redirects: e.Redirects})
+	}
+	return true
+}
+
+// classify возвращает первое правило, под которое подпадает ответ. Если подходящего правила нет,
+// ссылка считается рабочей
+func (s *Service) classify(u *url.URL, status int, header http.Header) rule {
+	for _, r := range s.rules {
+		if r.match(u, status, header) {
+			return r
+		}
+	}
+	return rule{name: "default", outcome: OutcomeOK}
+}
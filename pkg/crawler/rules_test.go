@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_rules(t *testing.T) {
+	var ignoredRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bad-request", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	mux.HandleFunc("/teapot", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	mux.HandleFunc("/private", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	mux.HandleFunc("/deprecated", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/ignored/page", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ignoredRequests, 1)
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/bad-request">1</a><a href="/teapot">2</a><a href="/private">3</a>`+
+			`<a href="/deprecated">4</a><a href="/ignored/page">5</a>`)
+	})
+
+	cfg := &conf.Config{Rule: map[string]*conf.Rule{
+		"private":    {Order: 1, Status: []string{"401-403"}, Outcome: "warning", Message: "Authorization required"},
+		"deprecated": {Order: 2, Header: []string{"Deprecation: true"}, Outcome: "warning"},
+		"ignored":    {Order: 3, URL: []string{`/ignored/`}, Outcome: "ignored"},
+	}}
+	if err := CheckRules(cfg); err != nil {
+		t.Fatal(err)
+	}
+	s := runScan(t, cfg, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1})
+
+	got := make([]string, 0)
+	for u, e := range s.Errors {
+		got = append(got, fmt.Sprintf("error %s %d", u, e.HTTPStatus))
+	}
+	for _, f := range s.Findings {
+		got = append(got, fmt.Sprintf("%s %s %s", f.Category, f.URL, f.Message))
+	}
+	for u, sk := range s.Skipped {
+		got = append(got, fmt.Sprintf("skipped %s %s", u, sk.Reason))
+	}
+	sort.Strings(got)
+	want := []string{
+		"error " + s.URL + "/bad-request 400",
+		"skipped " + s.URL + "/ignored/page " + SkippedByRule + ": ignored",
+		FindingWarning + " " + s.URL + "/deprecated 200 OK",
+		FindingWarning + " " + s.URL + "/private Authorization required",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Результаты:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+	if n := atomic.LoadInt32(&ignoredRequests); n != 0 {
+		t.Errorf("Игнорируемая ссылка запрошена %d раз, ожидается 0", n)
+	}
+
+	if err := CheckRules(&conf.Config{Rule: map[string]*conf.Rule{"bad": {Status: []string{"5xx"}, Outcome: "broken"}}}); err == nil {
+		t.Error("Ожидается ошибка для неверного кода ответа")
+	}
+	if err := CheckRules(&conf.Config{Rule: map[string]*conf.Rule{"bad": {Outcome: "fatal"}}}); err == nil {
+		t.Error("Ожидается ошибка для неизвестного результата")
+	}
+}
+
+func TestService_errorBudget(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(w, `<a href="/missing-%d">%d</a>`, i, i)
+		}
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Ссылки, уже переданные обработчикам, проверяются и после превышения бюджета
+	tests := []struct {
+		name  string
+		cfg   int
+		sched int
+		min   int
+		max   int
+	}{
+		{"config", 2, 0, 3, 5},
+		{"schedule", 2, 4, 5, 7},
+		{"unlimited", 2, -1, 10, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := runScan(t, &conf.Config{Crawler: conf.Crawler{MaxErrors: tt.cfg}}, nil, conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: -1, MaxErrors: tt.sched})
+			if n := len(s.Errors); n < tt.min || n > tt.max {
+				t.Errorf("Ошибок: получено %d, ожидается от %d до %d", n, tt.min, tt.max)
+			}
+		})
+	}
+}
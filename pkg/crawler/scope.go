@@ -0,0 +1,133 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"blc/pkg/conf"
+)
+
+// Части URL, к которым применяются шаблоны области сканирования
+const (
+	scopeURL   = "url"
+	scopeHost  = "host"
+	scopePath  = "path"
+	scopeQuery = "query"
+)
+
+// scopePattern это шаблон области сканирования, применяемый к одной из частей URL
+type scopePattern struct {
+	part string
+	re   *regexp.Regexp
+}
+
+// scope это правила области сканирования: ссылка входит в область, если подходит хотя бы под один
+// шаблон Include (или их нет) и не подходит ни под один шаблон Exclude
+type scope struct {
+	include []scopePattern
+	exclude []scopePattern
+}
+
+// CheckScope проверяет шаблоны области сканирования
+func CheckScope(sched conf.ScheduleData) error {
+	_, err := newScope(sched)
+	return err
+}
+
+// newScope разбирает шаблоны области сканирования. Исключенные URL (ExcludedURL) добавляются как точные совпадения
+func newScope(sched conf.ScheduleData) (scope, error) {
+	var sc scope
+	for _, p := range sched.Include {
+		sp, err := parseScopePattern(p)
+		if err != nil {
+			return scope{}, err
+		}
+		sc.include = append(sc.include, sp)
+	}
+	for _, p := range sched.Exclude {
+		sp, err := parseScopePattern(p)
+		if err != nil {
+			return scope{}, err
+		}
+		sc.exclude = append(sc.exclude, sp)
+	}
+	for _, u := range sched.ExcludedURL {
+		sc.exclude = append(sc.exclude, scopePattern{part: scopeURL, re: regexp.MustCompile("^" + regexp.QuoteMeta(u) + "$")})
+	}
+	return sc, nil
+}
+
+// parseScopePattern разбирает шаблон вида [host:|path:|query:|url:][re:]pattern.
+// Без префикса "re:" шаблон - glob, в котором "*" означает любую последовательность символов,
+// без указания части URL шаблон применяется ко всему URL
+func parseScopePattern(p string) (scopePattern, error) {
+	sp := scopePattern{part: scopeURL}
+	for _, part := range []string{scopeURL, scopeHost, scopePath, scopeQuery} {
+		if strings.HasPrefix(p, part+":") && !strings.HasPrefix(p, part+"://") {
+			sp.part = part
+			p = p[len(part)+1:]
+			break
+		}
+	}
+	if strings.HasPrefix(p, "re:") {
+		re, err := regexp.Compile(p[3:])
+		if err != nil {
+			return sp, fmt.Errorf("scope pattern %q: %v", p, err)
+		}
+		sp.re = re
+		return sp, nil
+	}
+	if p == "" {
+		return sp, fmt.Errorf("empty scope pattern")
+	}
+	sp.re = regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*") + "$")
+	return sp, nil
+}
+
+// match проверяет, подходит ли URL под шаблон
+func (sp scopePattern) match(u *url.URL) bool {
+	switch sp.part {
+	case scopeHost:
+		return sp.re.MatchString(strings.ToLower(u.Hostname()))
+	case scopePath:
+		p := u.EscapedPath()
+		if p == "" {
+			p = "/"
+		}
+		return sp.re.MatchString(p)
+	case scopeQuery:
+		return sp.re.MatchString(u.RawQuery)
+	}
+	return sp.re.MatchString(u.String())
+}
+
+// seed проверяет, является ли ссылка стартовым URL сканирования
+func (s *Service) seed(link string) bool {
+	for _, u := range s.sched.URL {
+		if u == link {
+			return true
+		}
+	}
+	return false
+}
+
+// inScope проверяет, входит ли ссылка в область сканирования.
+// Шаблоны Include ограничивают только внутренние ссылки, шаблоны Exclude применяются ко всем ссылкам
+func (s *Service) inScope(u *url.URL) bool {
+	for _, sp := range s.scope.exclude {
+		if sp.match(u) {
+			return false
+		}
+	}
+	if len(s.scope.include) == 0 || !s.internal(u) {
+		return true
+	}
+	for _, sp := range s.scope.include {
+		if sp.match(u) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_scope(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/blog/post.html">post</a><a href="/blog/?sort=date">sorted</a><a href="/admin/users">admin</a>`+
+			`<a href="/tag/go">tag</a><a href="/about.html">about</a><a href="/excluded.html">excluded</a>`+
+			`<a href="http://staging.example.com/">staging</a>`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	sched := conf.ScheduleData{
+		URL:         []string{ts.URL + "/"},
+		Depth:       2,
+		ExcludedURL: []string{ts.URL + "/excluded.html"},
+		Include:     []string{"path:/blog/*", "path:/tag/*", "path:/admin/*"},
+		Exclude:     []string{"query:*sort=*", "host:*.example.com", "path:re:^/(admin|tag)/"},
+	}
+	if err := CheckScope(sched); err != nil {
+		t.Fatal(err)
+	}
+	s := runScan(t, nil, nil, sched)
+
+	got := make([]string, 0)
+	for u := range s.Processed {
+		got = append(got, u)
+	}
+	sort.Strings(got)
+	want := []string{ts.URL + "/", ts.URL + "/blog/post.html"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Processed:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+
+	got = got[:0]
+	for u, sk := range s.Skipped {
+		if sk.Reason == SkippedOutOfScope {
+			got = append(got, u)
+		}
+	}
+	sort.Strings(got)
+	want = []string{
+		"http://staging.example.com/",
+		ts.URL + "/about.html",
+		ts.URL + "/admin/users",
+		ts.URL + "/blog/?sort=date",
+		ts.URL + "/excluded.html",
+		ts.URL + "/tag/go",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Out of scope:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+
+	if err := CheckScope(conf.ScheduleData{Exclude: []string{"path:re:("}}); err == nil {
+		t.Error("Ожидается ошибка для неверного регулярного выражения")
+	}
+}
@@ -0,0 +1,178 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Ограничения при разборе sitemap
+const (
+	// Максимальный размер распакованного файла sitemap (по протоколу sitemaps.org)
+	maxSitemapSize = 50 * 1024 * 1024
+	// Максимальная вложенность индексов sitemap
+	maxSitemapDepth = 3
+	// Максимальное количество файлов sitemap для одного сканирования
+	maxSitemapFiles = 1000
+)
+
+// sitemapXML описывает файл sitemap (urlset) и индекс sitemap (sitemapindex)
+type sitemapXML struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// sitemapSeeds загружает sitemap для стартовых URL и возвращает найденные в них ссылки для сканирования.
+// Если список sitemapURLs пуст, sitemap ищутся в robots.txt хостов стартовых URL, иначе берется /sitemap.xml
+func (s *Service) sitemapSeeds(urls []string, sitemapURLs []string, depth int) []task {
+	if len(sitemapURLs) == 0 {
+		discovered := make(map[string]bool)
+		for _, link := range urls {
+			u, err := url.Parse(link)
+			if err != nil || u.Host == "" {
+				continue
+			}
+			root := u.Scheme + "://" + u.Host
+			if discovered[root] {
+				continue
+			}
+			discovered[root] = true
+			fromRobots := s.robotsRules(u).sitemaps
+			if len(fromRobots) == 0 {
+				fromRobots = []string{root + "/sitemap.xml"}
+			}
+			sitemapURLs = append(sitemapURLs, fromRobots...)
+		}
+	}
+
+	visited := make(map[string]bool)
+	seeds := make([]task, 0)
+	for _, sm := range sitemapURLs {
+		for _, link := range s.loadSitemap(sm, 0, visited) {
+			// Ссылки sitemap сопоставляются со ссылками страниц по канонической форме
+			key := s.canonical(link)
+			s.mux.Lock()
+			_, listed := s.sitemap[key]
+			if !listed {
+				s.sitemap[key] = link
+			}
+			s.mux.Unlock()
+			if listed {
+				continue
+			}
+			d := depth
+			if u, err := url.Parse(link); err != nil || !s.internal(u) {
+				d = 1
+			}
+			seeds = append(seeds, task{link: link, baseLink: link, depth: d, key: key})
+		}
+	}
+	s.logger.Info(fmt.Sprintf("Sitemap, ID: %d: %d URLs found", s.ID, len(seeds)))
+	return seeds
+}
+
+// loadSitemap загружает файл sitemap (в т.ч. сжатый gzip) и возвращает перечисленные в нем ссылки.
+// Индексы sitemap обрабатываются рекурсивно
+func (s *Service) loadSitemap(link string, level int, visited map[string]bool) []string {
+	if level >= maxSitemapDepth || len(visited) >= maxSitemapFiles || visited[link] {
+		return nil
+	}
+	visited[link] = true
+
+	u, err := url.Parse(link)
+	if err != nil {
+		s.addFinding(Finding{Category: FindingSitemap, URL: link, Message: fmt.Sprintf("Sitemap URL parse error: %v", err)})
+		return nil
+	}
+	request, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		s.addFinding(Finding{Category: FindingSitemap, URL: link, Message: fmt.Sprintf("Sitemap request error: %v", err)})
+		return nil
+	}
+	request.Header.Add("User-Agent", userAgent)
+	s.authorize(request)
+	s.limiter.acquire(u.Hostname())
+	defer s.limiter.release(u.Hostname())
+	response, _, err := s.do(s.client, request, u.Hostname())
+	if err != nil {
+		s.addFinding(Finding{Category: FindingSitemap, URL: link, Message: fmt.Sprintf("Sitemap GET error: %v", err)})
+		return nil
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		s.addFinding(Finding{Category: FindingSitemap, URL: link, HTTPStatus: response.StatusCode, Message: "Sitemap is not available: " + response.Status})
+		return nil
+	}
+
+	body, err := sitemapReader(response)
+	if err != nil {
+		s.addFinding(Finding{Category: FindingSitemap, URL: link, HTTPStatus: response.StatusCode, Message: fmt.Sprintf("Sitemap read error: %v", err)})
+		return nil
+	}
+	var data sitemapXML
+	if err := xml.NewDecoder(io.LimitReader(body, maxSitemapSize)).Decode(&data); err != nil {
+		s.addFinding(Finding{Category: FindingSitemap, URL: link, HTTPStatus: response.StatusCode, Message: fmt.Sprintf("Sitemap parse error: %v", err)})
+		return nil
+	}
+
+	links := make([]string, 0, len(data.URLs))
+	for _, l := range data.URLs {
+		if loc := strings.TrimSpace(l.Loc); loc != "" {
+			links = append(links, loc)
+		}
+	}
+	for _, sm := range data.Sitemaps {
+		if loc := strings.TrimSpace(sm.Loc); loc != "" {
+			links = append(links, s.loadSitemap(loc, level+1, visited)...)
+		}
+	}
+	return links
+}
+
+// sitemapReader возвращает тело ответа, распаковывая его, если sitemap сжат gzip
+func sitemapReader(response *http.Response) (io.Reader, error) {
+	body := bufio.NewReader(response.Body)
+	magic, err := body.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// Сжатые файлы определяем по сигнатуре gzip, т.к. заголовки часто не соответствуют содержимому
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(body)
+	}
+	return body, nil
+}
+
+// sitemapFindings дополняет отчет замечаниями по ссылкам из sitemap: битые ссылки и страницы,
+// на которые нет ссылок с других страниц сайта
+func (s *Service) sitemapFindings() {
+	s.mux.RLock()
+	// Ошибки хранятся по ссылкам в том виде, в котором они найдены, а sitemap - по канонической форме
+	errs := make(map[string]ErrorResult, len(s.Errors))
+	for link, e := range s.Errors {
+		errs[s.canonical(link)] = e
+	}
+	findings := make([]Finding, 0)
+	for key, link := range s.sitemap {
+		if e, ok := errs[key]; ok {
+			findings = append(findings, Finding{Category: FindingSitemap, URL: link, HTTPStatus: e.HTTPStatus, Message: "Listed in sitemap but broken: " + e.Error})
+			continue
+		}
+		if s.visited[key] && !s.linked[key] {
+			findings = append(findings, Finding{Category: FindingOrphan, URL: link, Message: "Listed in sitemap but not linked from any page"})
+		}
+	}
+	s.mux.RUnlock()
+	for _, f := range findings {
+		s.addFinding(f)
+	}
+}
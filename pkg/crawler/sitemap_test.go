@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"blc/pkg/conf"
+)
+
+func TestService_sitemap(t *testing.T) {
+	var ts *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nSitemap: %s/sitemap-index.xml\n", ts.URL)
+	})
+	mux.HandleFunc("/sitemap-index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>%s/sitemap.xml.gz</loc></sitemap>
+</sitemapindex>`, ts.URL)
+	})
+	mux.HandleFunc("/sitemap.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		gz := gzip.NewWriter(w)
+		fmt.Fprintf(gz, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/</loc></url>
+<url><loc>%[1]s/linked.html</loc></url>
+<url><loc>%[1]s/orphan.html</loc></url>
+<url><loc>%[1]s/broken.html?utm_source=sitemap</loc></url>
+<url><loc>%[1]s/moved.html</loc></url>
+</urlset>`, ts.URL)
+		gz.Close()
+	})
+	mux.HandleFunc("/moved.html", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/linked.html", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/broken.html", http.NotFound)
+	var home int32
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			atomic.AddInt32(&home, 1)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/linked.html">linked</a>`)
+	})
+	ts = httptest.NewServer(mux)
+	defer ts.Close()
+
+	// Стартовые URL есть и в sitemap, битая страница указана в sitemap в другой форме
+	s := runScan(t, &conf.Config{Crawler: conf.Crawler{Workers: 2}}, nil, conf.ScheduleData{URL: []string{ts.URL + "/", ts.URL + "/broken.html"}, Depth: -1, Sitemap: true})
+	if n := atomic.LoadInt32(&home); n != 1 {
+		t.Errorf("Стартовая страница запрошена %d раз, ожидается 1", n)
+	}
+
+	got := make([]string, 0)
+	for _, f := range s.Findings {
+		got = append(got, f.Category+" "+f.URL)
+	}
+	sort.Strings(got)
+	want := []string{
+		FindingOrphan + " " + ts.URL + "/moved.html",
+		FindingOrphan + " " + ts.URL + "/orphan.html",
+		FindingPermanentRedirect + " " + ts.URL + "/moved.html",
+		FindingSitemap + " " + ts.URL + "/broken.html?utm_source=sitemap",
+		FindingSitemap + " " + ts.URL + "/moved.html",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Findings:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+}
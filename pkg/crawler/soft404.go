@@ -0,0 +1,227 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+
+	"blc/pkg/conf"
+)
+
+// ErrorTypeSoft404 - страница отвечает 200, но выглядит как страница "не найдено"
+const ErrorTypeSoft404 = "soft 404"
+
+// Порог сходства со страницей "не найдено" по умолчанию
+const defaultSoft404Threshold = 0.85
+
+// Вес сходства заголовков в оценке, остальное - сходство текста
+const soft404TitleWeight = 0.3
+
+// Размер шингла - количество подряд идущих слов текста, по которым сравниваются страницы
+const shingleSize = 3
+
+// Сколько байт страницы-пробы читается
+const maxProbeSize = 1024 * 1024
+
+// probeKey - ключ контекста запроса пробы, значение - URL пробы. По нему запись в архив отмечает пробы
+type probeKey struct{}
+
+// pageFingerprint это заголовок и текст страницы в виде, удобном для сравнения
+type pageFingerprint struct {
+	title string
+	// Текст, в котором пути и числа заменены на "#", и исходный текст в нижнем регистре для поиска фраз
+	text     string
+	raw      string
+	shingles map[string]bool
+}
+
+// hostProbe это страница "не найдено" хоста, полученная запросом случайного URL
+type hostProbe struct {
+	once sync.Once
+	// Отпечаток страницы (nil - хост отвечает на несуществующие URL кодом ошибки)
+	page *pageFingerprint
+	// Конечный адрес, если случайный URL перенаправляет
+	redirect string
+}
+
+// soft404Detector сравнивает страницы со страницами "не найдено" их хостов
+type soft404Detector struct {
+	threshold float64
+	// Фразы в нижнем регистре
+	phrases []string
+	mux     sync.Mutex
+	probes  map[string]*hostProbe
+}
+
+// newSoft404Detector возвращает детектор с настройками из конфигурации
+func newSoft404Detector(cfg conf.Crawler) *soft404Detector {
+	d := soft404Detector{threshold: cfg.Soft404Threshold, probes: make(map[string]*hostProbe)}
+	if d.threshold <= 0 {
+		d.threshold = defaultSoft404Threshold
+	}
+	for _, p := range cfg.Soft404Phrase {
+		if p = strings.Join(strings.Fields(strings.ToLower(p)), " "); p != "" {
+			d.phrases = append(d.phrases, p)
+		}
+	}
+	return &d
+}
+
+// fingerprint возвращает отпечаток HTML-страницы
+func fingerprint(page *html.Node) *pageFingerprint {
+	var title string
+	var words, raw []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "script", "style", "noscript", "template":
+				return
+			case "title":
+				if title == "" && n.FirstChild != nil {
+					title = strings.Join(strings.Fields(strings.ToLower(n.FirstChild.Data)), " ")
+				}
+				return
+			}
+		}
+		if n.Type == html.TextNode {
+			for _, w := range strings.Fields(strings.ToLower(n.Data)) {
+				raw = append(raw, w)
+				// Страницы "не найдено" часто повторяют запрошенный путь: пути и числа не различаются
+				if strings.ContainsAny(w, "/0123456789") {
+					w = "#"
+				}
+				words = append(words, w)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(page)
+	fp := pageFingerprint{title: title, text: strings.Join(words, " "), raw: strings.Join(raw, " "), shingles: make(map[string]bool)}
+	if len(words) > 0 && len(words) < shingleSize {
+		fp.shingles[fp.text] = true
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		fp.shingles[strings.Join(words[i:i+shingleSize], " ")] = true
+	}
+	return &fp
+}
+
+// jaccard возвращает отношение размеров пересечения и объединения множеств (0 для пустых множеств)
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for k := range a {
+		if b[k] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// similarity возвращает сходство страниц от 0 до 1 по заголовкам и тексту
+func (fp *pageFingerprint) similarity(other *pageFingerprint) float64 {
+	var title float64
+	switch {
+	case fp.title == "" || other.title == "":
+	case fp.title == other.title:
+		title = 1
+	default:
+		a, b := make(map[string]bool), make(map[string]bool)
+		for _, w := range strings.Fields(fp.title) {
+			a[w] = true
+		}
+		for _, w := range strings.Fields(other.title) {
+			b[w] = true
+		}
+		title = jaccard(a, b)
+	}
+	return soft404TitleWeight*title + (1-soft404TitleWeight)*jaccard(fp.shingles, other.shingles)
+}
+
+// probe возвращает страницу "не найдено" хоста ссылки u, запрашивая ее при первом обращении
+// по случайному URL, которого на сайте заведомо нет. При воспроизведении из архива запрашивается
+// записанный в архив URL пробы
+func (s *Service) probe(u *url.URL) *hostProbe {
+	key := u.Scheme + "://" + strings.ToLower(u.Host)
+	d := s.soft404
+	d.mux.Lock()
+	p, ok := d.probes[key]
+	if !ok {
+		p = &hostProbe{}
+		d.probes[key] = p
+	}
+	d.mux.Unlock()
+	p.once.Do(func() {
+		link := key + "/" + uuid.New().String()
+		if f, ok := s.fetcher.(*replayFetcher); ok && f.probes[key] != "" {
+			link = f.probes[key]
+		}
+		request, err := http.NewRequest(http.MethodGet, link, nil)
+		if err != nil {
+			return
+		}
+		request = request.WithContext(context.WithValue(request.Context(), probeKey{}, link))
+		request.Header.Add("User-Agent", userAgent)
+		s.authorize(request)
+		// Место хоста занято запросом проверяемой страницы
+		release := s.limit(u.Hostname(), u.Hostname())
+		defer release()
+		response, err := s.client.Do(request)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("Soft 404 probe, ID: %d: %v", s.ID, err))
+			return
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK || !strings.Contains(response.Header.Get("Content-Type"), "text/html") {
+			io.Copy(ioutil.Discard, io.LimitReader(response.Body, maxProbeSize))
+			return
+		}
+		if response.Request.Response != nil {
+			p.redirect = response.Request.URL.String()
+		}
+		if page, err := html.Parse(io.LimitReader(response.Body, maxProbeSize)); err == nil {
+			p.page = fingerprint(page)
+		}
+	})
+	return p
+}
+
+// soft404Check проверяет, что страница page, полученная по ссылке u с ответом response, является страницей "не найдено".
+// Возвращает оценку сходства и описание, если является
+func (s *Service) soft404Check(u *url.URL, response *http.Response, page *html.Node) (float64, string, bool) {
+	fp := fingerprint(page)
+	for _, phrase := range s.soft404.phrases {
+		if strings.Contains(fp.title, phrase) || strings.Contains(fp.raw, phrase) {
+			return 1, fmt.Sprintf("page contains %q", phrase), true
+		}
+	}
+	p := s.probe(u)
+	if p.redirect != "" && response.Request.URL.String() == p.redirect {
+		// Сайт перенаправляет несуществующие URL на одну страницу: сама эта страница рабочая
+		if response.Request.Response == nil {
+			return 0, "", false
+		}
+		return 1, "redirects to " + p.redirect + " like a missing URL", true
+	}
+	if p.page == nil {
+		return 0, "", false
+	}
+	score := fp.similarity(p.page)
+	if score < s.soft404.threshold {
+		return score, "", false
+	}
+	return score, "page looks like the not-found page of the host", true
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+
+	"blc/pkg/conf"
+)
+
+func TestService_soft404(t *testing.T) {
+	// Сайт перенаправляет несуществующие URL на главную страницу
+	home := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Home</title><p>Welcome to our home page</p>`)
+	}))
+	defer home.Close()
+	// CMS отвечает на несуществующие URL кодом 200 и шаблоном "не найдено"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		const header = `<header>Site menu: about, products, contacts, blog</header>`
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<title>Main</title>%s<a href="/article">article</a> <a href="/old-page">old</a> `+
+				`<a href="/gone">gone</a> <a href="/promo">promo</a> <a href="/removed">removed</a> <a href="%s/missing">missing</a> <a href="%s/">home</a>`,
+				header, home.URL, home.URL)
+		case "/article":
+			fmt.Fprintf(w, `<title>How we test links</title>%s<p>Broken links hurt users and search rankings, `+
+				`so every night a crawler walks the whole site and reports what it finds.</p>`, header)
+		case "/promo":
+			fmt.Fprintf(w, `<title>Spring sale</title>%s<p>This offer is no longer available.</p>`, header)
+		case "/removed":
+			fmt.Fprintf(w, `<title>Product 1024</title>%s<p>Error 404: this product was removed in 2020.</p>`, header)
+		case "/gone":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprintf(w, `<title>Page not found</title>%s<p>Sorry, the page %s could not be found. `+
+				`Please check the address or use the search.</p>`, header, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		soft404 bool
+		errors  map[string]string
+	}{
+		{
+			name:   "disabled",
+			errors: map[string]string{ts.URL + "/gone": ""},
+		},
+		{
+			name:    "enabled",
+			soft404: true,
+			errors: map[string]string{
+				ts.URL + "/gone":      "",
+				ts.URL + "/old-page":  ErrorTypeSoft404,
+				ts.URL + "/promo":     ErrorTypeSoft404,
+				ts.URL + "/removed":   ErrorTypeSoft404,
+				home.URL + "/missing": ErrorTypeSoft404,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := conf.Config{Crawler: conf.Crawler{Soft404Phrase: []string{"No longer available", "error  404:"}}}
+			s := runScan(t, &cfg, nil, conf.ScheduleData{URL: []string{ts.URL + "/"}, Depth: 2, IgnoreRobots: true, Soft404: tt.soft404})
+
+			errs := make(map[string]string)
+			for link, e := range s.Errors {
+				errs[link] = e.Type
+				if e.Type == ErrorTypeSoft404 && !strings.Contains(e.Error, "score") {
+					t.Errorf("%s: no score in %q", link, e.Error)
+				}
+			}
+			if !reflect.DeepEqual(errs, tt.errors) {
+				t.Errorf("Errors:\r\nполучено: %v\r\nожидается: %v", errs, tt.errors)
+			}
+		})
+	}
+
+	missingA := fingerprint(mustParseHTML(t, `<title>Page not found</title><p>Sorry, the page /a could not be found.</p>`))
+	missingB := fingerprint(mustParseHTML(t, `<title>Page not found</title><p>Sorry, the page /b could not be found.</p>`))
+	if score := missingA.similarity(missingB); score < defaultSoft404Threshold {
+		t.Errorf("Similarity of not-found pages: %.2f", score)
+	}
+}
+
+func mustParseHTML(t *testing.T, s string) *html.Node {
+	page, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"blc/pkg/conf"
+)
+
+// Пределы для обнаружения ловушек по умолчанию
+const (
+	// Количество повторов одного сегмента пути
+	defaultMaxSegmentRepeats = 3
+	// Количество сегментов пути
+	defaultMaxPathSegments = 20
+	// Количество различных строк запроса для одного пути
+	defaultMaxQueryVariants = 100
+	// Длина URL
+	defaultMaxURLLength = 2048
+)
+
+// trapDetector обнаруживает ловушки - бесконечные пространства URL (календари, фасетный поиск,
+// относительные ссылки, наращивающие путь). Для ссылок, попавших в ловушку, проверяется только ответ,
+// ссылки с их страниц не сканируются. О каждой ловушке сообщается один раз
+type trapDetector struct {
+	// Пределы, отрицательное значение отключает проверку
+	maxSegmentRepeats int
+	maxPathSegments   int
+	maxQueryVariants  int
+	maxURLLength      int
+	mux               sync.Mutex
+	// Строки запроса, встреченные для каждого пути
+	variants map[string]map[string]bool
+	// Обнаруженные ловушки
+	found map[string]bool
+}
+
+// newTrapDetector возвращает детектор ловушек с пределами из конфигурации
+func newTrapDetector(cfg conf.Crawler) *trapDetector {
+	d := trapDetector{
+		maxSegmentRepeats: cfg.MaxSegmentRepeats,
+		maxPathSegments:   cfg.MaxPathSegments,
+		maxQueryVariants:  cfg.MaxQueryVariants,
+		maxURLLength:      cfg.MaxURLLength,
+		variants:          make(map[string]map[string]bool),
+		found:             make(map[string]bool),
+	}
+	if d.maxSegmentRepeats == 0 {
+		d.maxSegmentRepeats = defaultMaxSegmentRepeats
+	}
+	if d.maxPathSegments == 0 {
+		d.maxPathSegments = defaultMaxPathSegments
+	}
+	if d.maxQueryVariants == 0 {
+		d.maxQueryVariants = defaultMaxQueryVariants
+	}
+	if d.maxURLLength == 0 {
+		d.maxURLLength = defaultMaxURLLength
+	}
+	return &d
+}
+
+// check проверяет каноническую форму ссылки. Возвращает ключ ловушки, в которую попала ссылка,
+// описание ловушки и признак того, что ловушка обнаружена впервые
+func (d *trapDetector) check(u *url.URL) (string, string, bool) {
+	var segments []string
+	for _, seg := range strings.Split(u.EscapedPath(), "/") {
+		if seg != "" {
+			segments = append(segments, seg)
+		}
+	}
+	// Ловушки с длинными путями группируются по хосту и первому сегменту пути
+	prefix := u.Host + "/"
+	if len(segments) > 0 {
+		prefix += segments[0]
+	}
+	var key, message string
+	switch {
+	case d.maxURLLength > 0 && len(u.String()) > d.maxURLLength:
+		key = "length " + prefix
+		message = fmt.Sprintf("URL is longer than %d characters", d.maxURLLength)
+	case d.maxPathSegments > 0 && len(segments) > d.maxPathSegments:
+		key = "depth " + prefix
+		message = fmt.Sprintf("Path is longer than %d segments", d.maxPathSegments)
+	case d.maxSegmentRepeats > 0:
+		repeats := make(map[string]int, len(segments))
+		for _, seg := range segments {
+			repeats[seg]++
+			if repeats[seg] > d.maxSegmentRepeats {
+				key = "repeat " + u.Host + "/" + seg
+				message = fmt.Sprintf("Path segment %q repeats more than %d times", seg, d.maxSegmentRepeats)
+				break
+			}
+		}
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if key == "" && d.maxQueryVariants > 0 && u.RawQuery != "" {
+		page := u.Host + u.EscapedPath()
+		key = "query " + page
+		if !d.found[key] {
+			queries, ok := d.variants[page]
+			if !ok {
+				queries = make(map[string]bool)
+				d.variants[page] = queries
+			}
+			if queries[u.RawQuery] || len(queries) < d.maxQueryVariants {
+				queries[u.RawQuery] = true
+				return "", "", false
+			}
+		}
+		message = fmt.Sprintf("More than %d query variants of %s", d.maxQueryVariants, u.EscapedPath())
+	}
+	if key == "" {
+		return "", "", false
+	}
+	first := !d.found[key]
+	d.found[key] = true
+	return key, message, first
+}
+
+// trapped проверяет, попала ли ссылка u со страницы t в ловушку. key - каноническая форма ссылки.
+// При первом обнаружении ловушки добавляет замечание
+func (s *Service) trapped(t task, u *url.URL, key string) bool {
+	if !s.internal(u) {
+		return false
+	}
+	c, err := url.Parse(key)
+	if err != nil {
+		c = u
+	}
+	trap, message, first := s.traps.check(c)
+	if trap == "" {
+		return false
+	}
+	if first {
+		s.logger.Info(fmt.Sprintf("Crawl trap, ID: %d: %s: %s", s.ID, u, message))
+		s.addFinding(Finding{Category: FindingCrawlTrap, URL: u.String(), Message: message + ", links are not followed", ParentURL: t.link})
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"blc/pkg/conf"
+)
+
+func TestService_traps(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch {
+		case r.URL.Path == "/":
+			fmt.Fprint(w, `<a href="/calendar?month=1">calendar</a><a href="/a/">a</a><a href="/deep/">deep</a>`)
+		case r.URL.Path == "/calendar":
+			// Следующий месяц есть всегда
+			month, _ := strconv.Atoi(r.URL.Query().Get("month"))
+			fmt.Fprintf(w, `<a href="/calendar?month=%d">next</a><a href="/calendar?month=%d&utm_source=cal">next</a>`, month+1, month)
+		case strings.HasPrefix(r.URL.Path, "/a/"):
+			// Ссылка наращивает путь
+			fmt.Fprintf(w, `<a href="%sa/">a</a>`, r.URL.Path)
+		case strings.HasPrefix(r.URL.Path, "/deep/"):
+			fmt.Fprintf(w, `<a href="%s%d/">deeper</a>`, r.URL.Path, strings.Count(r.URL.Path, "/"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	cfg := &conf.Config{}
+	cfg.Crawler.MaxQueryVariants = 5
+	cfg.Crawler.MaxPathSegments = 6
+	var s *testScan
+	done := make(chan bool)
+	go func() {
+		s = runScan(t, cfg, mux, conf.ScheduleData{URL: []string{"/"}, Depth: -1})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Сканирование не завершилось")
+	}
+
+	got := make([]string, 0)
+	for _, f := range s.Findings {
+		if f.Category == FindingCrawlTrap {
+			got = append(got, f.URL+": "+f.Message)
+		}
+	}
+	sort.Strings(got)
+	want := []string{
+		s.URL + "/a/a/a/a/: Path segment \"a\" repeats more than 3 times, links are not followed",
+		s.URL + "/calendar?month=6: More than 5 query variants of /calendar, links are not followed",
+		s.URL + "/deep/2/3/4/5/6/7/: Path is longer than 6 segments, links are not followed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Findings:\r\nполучено: %v\r\nожидается: %v", got, want)
+	}
+	// Ссылки, попавшие в ловушку, проверяются, но ссылки с их страниц не сканируются
+	for _, path := range []string{"/a/a/a/a/", "/calendar?month=6", "/deep/2/3/4/5/6/7/"} {
+		if !s.Processed[s.URL+path] {
+			t.Errorf("%s не проверен", path)
+		}
+	}
+	for _, path := range []string{"/a/a/a/a/a/", "/calendar?month=7", "/deep/2/3/4/5/6/7/8/"} {
+		if s.Processed[s.URL+path] {
+			t.Errorf("%s проверен", path)
+		}
+	}
+	if len(s.Processed) != 18 {
+		t.Errorf("Processed: %d, ожидается 18", len(s.Processed))
+	}
+}
@@ -30,6 +30,10 @@ type JSONData struct {
 	TotalLinks   int
 	URLs         []string
 	Errors       map[string]crawler.ErrorResult
+	Skipped      map[string]crawler.SkipResult
+	Findings     []crawler.Finding
+	Certificates []crawler.CertificateIssue
+	StopReason   string
 }
 
 // Save saves a report in file
@@ -218,6 +222,11 @@ func mailHTMLBody(repData JSONData) (string, error) {
 		</div>
 		<div style="font-weight: bold;">Total links processed: {{ .TotalLinks }}</div>
 		<div style="font-weight: bold; color: #dc3545;">Total errors: {{len .Errors }}</div>
+		{{if len .Skipped}}<div style="font-weight: bold;">Skipped links: {{len .Skipped }}</div>{{end}}
+		{{with outOfScope .Skipped}}<div style="font-weight: bold;">Out of scope: {{.}}</div>{{end}}
+		{{if len .Findings}}<div style="font-weight: bold; color: #fd7e14;">Findings: {{len .Findings }}</div>{{end}}
+		{{if len .Certificates}}<div style="font-weight: bold; color: #fd7e14;">TLS certificate issues: {{len .Certificates }}</div>{{end}}
+		{{if .StopReason}}<div style="font-weight: bold; color: #dc3545;">Scan stopped early ({{.StopReason}}), the report is partial</div>{{end}}
 		<br />
 		{{if len .Errors}}
 		<table border="0" cellspacing="0" cellpadding="3" class="tbl">
@@ -234,8 +243,75 @@ func mailHTMLBody(repData JSONData) (string, error) {
 				<tr>
 					<td>{{$url}}</td>
 					<td>{{$err.HTTPStatus}}</td>
-					<td>{{$err.Error}}</td>
-					<td>{{$err.ParentURL}}</td>
+					<td>{{if $err.Type}}[{{$err.Type}}] {{end}}{{if $err.Kind}}Broken {{$err.Kind}}: {{end}}{{$err.Error}}{{if $err.Retry}} ({{$err.Retry}}){{end}}{{if $err.Method}}<br />Method: {{$err.Method}}{{end}}{{if $err.Redirects}}<br />Redirects: {{formatRedirects $err.Redirects $err.FinalURL}}{{end}}</td>
+					<td>{{range $i, $p := formatParents $err}}{{if $i}}<br />{{end}}{{$p}}{{end}}</td>
+				</tr>
+			{{end}}
+			</tbody>
+		</table>
+		{{end}}
+		{{if len .Findings}}
+		<h2>Findings</h2>
+		<table border="0" cellspacing="0" cellpadding="3" class="tbl">
+			<thead>
+				<tr>
+					<th class="th th2 ls">Category</th>
+					<th class="th th1">URL</th>
+					<th class="th th3">Message</th>
+					<th class="th th4">Parent URL</th>
+				</tr>
+			</thead>
+			<tbody>
+			{{range $f := .Findings}}
+				<tr>
+					<td>{{$f.Category}}</td>
+					<td>{{$f.URL}}</td>
+					<td>{{$f.Message}}{{if $f.Redirects}}<br />Redirects: {{formatRedirects $f.Redirects $f.FinalURL}}{{end}}</td>
+					<td>{{$f.ParentURL}}</td>
+				</tr>
+			{{end}}
+			</tbody>
+		</table>
+		{{end}}
+		{{if len .Certificates}}
+		<h2>TLS certificates</h2>
+		<table border="0" cellspacing="0" cellpadding="3" class="tbl">
+			<thead>
+				<tr>
+					<th class="th th2 ls">Host</th>
+					<th class="th th2">Issue</th>
+					<th class="th th3">Message</th>
+					<th class="th th4">Certificate</th>
+				</tr>
+			</thead>
+			<tbody>
+			{{range $c := .Certificates}}
+				<tr>
+					<td>{{$c.Host}}</td>
+					<td>{{$c.Category}}</td>
+					<td>{{$c.Message}}</td>
+					<td>Subject: {{$c.Subject}}<br />Issuer: {{$c.Issuer}}<br />Expires: {{$c.NotAfter | formatTime}}</td>
+				</tr>
+			{{end}}
+			</tbody>
+		</table>
+		{{end}}
+		{{if len .Skipped}}
+		<h2>Skipped links</h2>
+		<table border="0" cellspacing="0" cellpadding="3" class="tbl">
+			<thead>
+				<tr>
+					<th class="th th1 ls">URL</th>
+					<th class="th th3">Reason</th>
+					<th class="th th4">Parent URL</th>
+				</tr>
+			</thead>
+			<tbody>
+			{{range $url, $skip := .Skipped}}
+				<tr>
+					<td>{{$url}}</td>
+					<td>{{$skip.Reason}}</td>
+					<td>{{$skip.ParentURL}}</td>
 				</tr>
 			{{end}}
 			</tbody>
@@ -244,7 +320,7 @@ func mailHTMLBody(repData JSONData) (string, error) {
 	</body>
 </html>
 `
-	t := template.Must(template.New("main").Funcs(template.FuncMap{"formatTime": formatTime, "formatDuration": formatDuration}).Parse(tpl))
+	t := template.Must(template.New("main").Funcs(template.FuncMap{"formatTime": formatTime, "formatDuration": formatDuration, "formatRedirects": formatRedirects, "formatParents": formatParents, "outOfScope": outOfScope}).Parse(tpl))
 
 	if err := t.Execute(buf, repData); err != nil {
 		return "", err
@@ -258,6 +334,102 @@ func formatTime(t time.Time) string {
 	return t.Format("Mon 2 Jan 2006, at 15:04:05 MST")
 }
 
+// outOfScope returns the number of links skipped as out of scope
+func outOfScope(skipped map[string]crawler.SkipResult) int {
+	n := 0
+	for _, s := range skipped {
+		if s.Reason == crawler.SkippedOutOfScope {
+			n++
+		}
+	}
+	return n
+}
+
+// formatRedirects returns redirect chain as a string: "A (301) -> B (302) -> C"
+func formatRedirects(chain []crawler.Redirect, final string) string {
+	steps := make([]string, 0, len(chain)+1)
+	for _, r := range chain {
+		steps = append(steps, fmt.Sprintf("%s (%d)", r.URL, r.HTTPStatus))
+	}
+	if final != "" {
+		steps = append(steps, final)
+	}
+	return strings.Join(steps, " -> ")
+}
+
+// Number of pages the broken link was found on listed in the HTML and email reports, the JSON report lists all of them
+const maxParents = 10
+
+// formatParents returns the pages the broken link was found on, one per line, e.g.
+// "https://example.com/, line 12, column 5 (a href, nofollow): Contact us"
+func formatParents(e crawler.ErrorResult) []string {
+	parents := e.Parents
+	if len(parents) == 0 {
+		parents = []crawler.LinkRef{{ParentURL: e.ParentURL, Text: e.Text, Tag: e.Tag, Attr: e.Attr, Line: e.Line, Column: e.Column, Page: e.Page, Nofollow: e.Nofollow}}
+	}
+	lines := make([]string, 0, maxParents+1)
+	for i, r := range parents {
+		if i == maxParents {
+			lines = append(lines, fmt.Sprintf("and %d more", len(parents)-maxParents))
+			break
+		}
+		lines = append(lines, formatRef(r))
+	}
+	return lines
+}
+
+// formatRef returns the page the link was found on with the position, element and text of the link
+func formatRef(r crawler.LinkRef) string {
+	s := r.ParentURL
+	switch {
+	case r.Line > 0 && r.Column > 0:
+		s += fmt.Sprintf(", line %d, column %d", r.Line, r.Column)
+	case r.Line > 0:
+		s += fmt.Sprintf(", line %d", r.Line)
+	case r.Page > 0:
+		s += fmt.Sprintf(", page %d", r.Page)
+	}
+	var details []string
+	if r.Tag != "" && r.Attr != "" {
+		details = append(details, r.Tag+" "+r.Attr)
+	}
+	if r.Nofollow {
+		details = append(details, "nofollow")
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	if r.Text != "" {
+		s += ": " + r.Text
+	}
+	return s
+}
+
+// formatRefs returns all pages the link was found on
+func formatRefs(refs []crawler.LinkRef) []string {
+	lines := make([]string, 0, len(refs))
+	for _, r := range refs {
+		lines = append(lines, formatRef(r))
+	}
+	return lines
+}
+
+// formatBool returns "yes" for true and an empty string for false
+func formatBool(v bool) string {
+	if v {
+		return "yes"
+	}
+	return ""
+}
+
+// formatNumber returns a positive number as a string and an empty string for zero
+func formatNumber(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
 // formatTime returns time.Time value as a string
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
@@ -294,17 +466,53 @@ URLs to scan:
 {{end}}
 Total links processed: {{ .TotalLinks }}
 Total errors: {{len .Errors }}
-
+{{with outOfScope .Skipped}}Out of scope: {{.}}
+{{end}}{{if .StopReason}}Scan stopped early ({{.StopReason}}), the report is partial
+{{end}}
 {{if len .Errors}}
 {{range $url, $err := .Errors}}
 URL: {{$url}}
 HTTP code: {{$err.HTTPStatus}}
-Error: {{$err.Error}}
-Parent URL: {{$err.ParentURL}}
+{{if $err.Kind}}Type: {{$err.Kind}}
+{{end}}{{if $err.Type}}Error type: {{$err.Type}}
+{{end}}Error: {{$err.Error}}
+{{if $err.Retry}}Attempts: {{$err.Retry}}
+{{end}}{{if $err.Method}}Method: {{$err.Method}}
+{{end}}{{if $err.Redirects}}Redirects: {{formatRedirects $err.Redirects $err.FinalURL}}
+{{end}}Found on:
+{{range formatParents $err}}  {{.}}
+{{end}}{{end}}
+{{end}}
+{{if len .Findings}}
+Findings: {{len .Findings }}
+{{range $f := .Findings}}
+Category: {{$f.Category}}
+URL: {{$f.URL}}
+Message: {{$f.Message}}
+{{if $f.Redirects}}Redirects: {{formatRedirects $f.Redirects $f.FinalURL}}
+{{end}}{{if $f.ParentURL}}Parent URL: {{$f.ParentURL}}
+{{end}}{{end}}
+{{end}}
+{{if len .Certificates}}
+TLS certificate issues: {{len .Certificates }}
+{{range $c := .Certificates}}
+Host: {{$c.Host}}
+Issue: {{$c.Category}}
+Message: {{$c.Message}}
+Subject: {{$c.Subject}}
+Issuer: {{$c.Issuer}}
+{{end}}
+{{end}}
+{{if len .Skipped}}
+Skipped links: {{len .Skipped }}
+{{range $url, $skip := .Skipped}}
+URL: {{$url}}
+Reason: {{$skip.Reason}}
+Parent URL: {{$skip.ParentURL}}
 {{end}}
 {{end}}
 `
-	t := template.Must(template.New("main").Parse(tpl))
+	t := template.Must(template.New("main").Funcs(template.FuncMap{"formatRedirects": formatRedirects, "formatParents": formatParents, "outOfScope": outOfScope}).Parse(tpl))
 
 	if err := t.Execute(buf, repData); err != nil {
 		return "", err
@@ -388,25 +596,81 @@ func CleanReports(maxReportsToStore int) error {
 }
 
 func csvReport(repData JSONData) ([]byte, error) {
-	if len(repData.Errors) == 0 {
+	if len(repData.Errors) == 0 && len(repData.Certificates) == 0 {
 		return nil, nil
 	}
-	records := make([][]string, 0, len(repData.Errors)+1)
-	records = append(records, []string{
-		"URL",
-		"HTTP code",
-		"Error",
-		"Parent URL",
-	})
+	records := make([][]string, 0, len(repData.Errors)+len(repData.Certificates)+3)
+	if len(repData.Errors) > 0 {
+		records = append(records, []string{
+			"URL",
+			"HTTP code",
+			"Error",
+			"Parent URL",
+			"Type",
+			"Tag",
+			"Attribute",
+			"Error type",
+			"Final URL",
+			"Redirects",
+			"Attempts",
+			"Method",
+			"Line",
+			"Column",
+			"Page",
+			"Link text",
+			"Nofollow",
+			"Found on",
+		})
+	}
 	for u, e := range repData.Errors {
 		record := []string{
 			u,
 			strconv.Itoa(e.HTTPStatus),
 			e.Error,
 			e.ParentURL,
+			e.Kind,
+			e.Tag,
+			e.Attr,
+			e.Type,
+			e.FinalURL,
+			formatRedirects(e.Redirects, ""),
+			e.Retry,
+			e.Method,
+			formatNumber(e.Line),
+			formatNumber(e.Column),
+			formatNumber(e.Page),
+			e.Text,
+			formatBool(e.Nofollow),
+			strings.Join(formatRefs(e.Parents), "\n"),
 		}
 		records = append(records, record)
 	}
+	// TLS certificate issues follow the errors as a separate table
+	if len(repData.Certificates) > 0 {
+		if len(records) > 0 {
+			records = append(records, []string{})
+		}
+		records = append(records, []string{
+			"Host",
+			"Certificate issue",
+			"Message",
+			"Subject",
+			"Issuer",
+			"Expires",
+			"URL",
+		})
+	}
+	for _, c := range repData.Certificates {
+		records = append(records, []string{
+			c.Host,
+			c.Category,
+			c.Message,
+			c.Subject,
+			c.Issuer,
+			formatTime(c.NotAfter),
+			c.URL,
+		})
+	}
 	var b bytes.Buffer
 	w := csv.NewWriter(&b)
 	w.WriteAll(records)
@@ -4,12 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 
 	"blc/pkg/auth"
+	"blc/pkg/conf"
 	"blc/pkg/crawler"
 	"blc/pkg/logger"
 )
@@ -30,12 +32,14 @@ type Service struct {
 	mux           sync.Mutex
 	router        *mux.Router
 	auth          *auth.Auth
-	delay         int
+	cfg           *conf.Config
 	chReport      chan *crawler.Service
+	// Ключи продолженных сканирований: каждое сохраненное состояние продолжается только одним процессом
+	resumed map[string]bool
 }
 
 // New возвращает новый объект службы
-func New(logger *logger.Logger, crawlers map[int]*crawler.Service, r *mux.Router, a *auth.Auth, delay int, chReport chan *crawler.Service) *Service {
+func New(logger *logger.Logger, crawlers map[int]*crawler.Service, r *mux.Router, a *auth.Auth, cfg *conf.Config, chReport chan *crawler.Service) *Service {
 	var s Service
 	s.upgrader = websocket.Upgrader{
 		CheckOrigin: func(r *http.Request) bool {
@@ -44,11 +48,17 @@ func New(logger *logger.Logger, crawlers map[int]*crawler.Service, r *mux.Router
 	}
 	s.crawlers = crawlers
 	s.nextCrawlerID = 100
+	if keys, err := crawler.Checkpoints(cfg); err != nil {
+		logger.Error(fmt.Sprintf("Checkpoints: %v", err))
+	} else if len(keys) > 0 {
+		logger.Info(fmt.Sprintf("Interrupted scans can be resumed: %s", strings.Join(keys, ", ")))
+	}
+	s.resumed = make(map[string]bool)
 	s.chMessages = make(map[int]chan string)
 	s.logger = logger
 	s.router = r
 	s.auth = a
-	s.delay = delay
+	s.cfg = cfg
 	s.chReport = chReport
 	return &s
 }
@@ -76,25 +86,68 @@ func (s *Service) PublishMessages(msgQueue chan crawler.ScanResult) {
 	}
 }
 
-// start получает список URL, стартует новый процесс сканирования и возвращает его идентификатор
-func (s *Service) start(urls []string, depth int) int {
-	if len(urls) == 0 {
+// start получает параметры сканирования, стартует новый процесс сканирования и возвращает его идентификатор.
+// workers > 0 переопределяет количество параллельных обработчиков из конфигурации
+func (s *Service) start(sched conf.ScheduleData, workers int) int {
+	if len(sched.URL) == 0 {
 		return 0
 	}
 	s.mux.Lock()
 	ID := s.nextCrawlerID
 	s.nextCrawlerID++
-	s.crawlers[ID] = crawler.New(ID, s.delay, s.chReport, s.logger)
+	s.crawlers[ID] = crawler.New(ID, s.cfg, s.chReport, s.logger)
+	if workers > 0 {
+		s.crawlers[ID].Workers = workers
+	}
 	s.mux.Unlock()
 
 	go s.PublishMessages(s.crawlers[ID].ChResults)
 	go func() {
-		s.crawlers[ID].Scan(urls, depth, "", []string{})
+		s.crawlers[ID].Scan(sched)
 	}()
 
 	return ID
 }
 
+// Resume продолжает прерванный процесс сканирования по ключу его сохраненного состояния в новом процессе
+// и возвращает идентификатор процесса
+func (s *Service) Resume(key string) (int, error) {
+	keys, err := crawler.Checkpoints(s.cfg)
+	if err != nil {
+		return 0, err
+	}
+	found := false
+	for _, k := range keys {
+		found = found || k == key
+	}
+	if !found {
+		return 0, fmt.Errorf("no saved state %q", key)
+	}
+
+	s.mux.Lock()
+	if s.resumed[key] {
+		s.mux.Unlock()
+		return 0, fmt.Errorf("scan %q is already resumed", key)
+	}
+	s.resumed[key] = true
+	ID := s.nextCrawlerID
+	s.nextCrawlerID++
+	crw := crawler.New(ID, s.cfg, s.chReport, s.logger)
+	s.crawlers[ID] = crw
+	s.mux.Unlock()
+
+	go s.PublishMessages(crw.ChResults)
+	go func() {
+		if err := crw.Resume(key); err != nil {
+			s.logger.Error(fmt.Sprintf("Resume, ID: %d: %v", ID, err))
+			s.mux.Lock()
+			delete(s.resumed, key)
+			s.mux.Unlock()
+		}
+	}()
+	return ID, nil
+}
+
 // Обработчик для /cmd принимает сообщение от пользователя
 func (s *Service) cmdHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := s.upgrader.Upgrade(w, r, nil)
@@ -126,10 +179,28 @@ func (s *Service) cmdHandler(w http.ResponseWriter, r *http.Request) {
 		s.logger.Info("/cmd: Command received: " + string(message))
 
 		var cmdData struct {
-			Cmd   string
-			URLs  []string
-			Depth int
-			ID    int
+			Cmd     string
+			URLs    []string
+			Depth   int
+			ID      int
+			Workers int
+			Sitemap bool
+			// Ключ сохраненного состояния для команды resume
+			Checkpoint string
+			// Проверять ссылки на фрагменты страниц
+			CheckFragments bool
+			// Проверять страницы "не найдено" с кодом 200
+			Soft404 bool
+			// Бюджет ошибок (0 - из конфигурации)
+			MaxErrors int
+			// Бюджеты сканирования (0 - без ограничений)
+			MaxPages        int
+			MaxPagesPerHost int
+			MaxDuration     int
+			MaxBytes        int64
+			// Шаблоны области сканирования
+			Include []string
+			Exclude []string
 		}
 		if err := json.Unmarshal(message, &cmdData); err != nil {
 			s.logger.Error("/cmd: Error: " + err.Error())
@@ -137,10 +208,34 @@ func (s *Service) cmdHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if cmdData.Cmd == "start" {
-			s.start(cmdData.URLs, cmdData.Depth)
+			sched := conf.ScheduleData{
+				URL:             cmdData.URLs,
+				Depth:           cmdData.Depth,
+				Sitemap:         cmdData.Sitemap,
+				CheckFragments:  cmdData.CheckFragments,
+				Soft404:         cmdData.Soft404,
+				MaxErrors:       cmdData.MaxErrors,
+				MaxPages:        cmdData.MaxPages,
+				MaxPagesPerHost: cmdData.MaxPagesPerHost,
+				MaxDuration:     cmdData.MaxDuration,
+				MaxBytes:        cmdData.MaxBytes,
+				Include:         cmdData.Include,
+				Exclude:         cmdData.Exclude,
+			}
+			if err := crawler.CheckScope(sched); err != nil {
+				s.logger.Error("/cmd: Error: " + err.Error())
+				continue
+			}
+			s.start(sched, cmdData.Workers)
 			s.logger.Info("/cmd: Start new process")
 			continue
 		}
+		if cmdData.Cmd == "resume" {
+			if _, err := s.Resume(cmdData.Checkpoint); err != nil {
+				s.logger.Error(fmt.Sprintf("/cmd[%s]: Error: %v", cmdData.Checkpoint, err))
+			}
+			continue
+		}
 
 		s.mux.Lock()
 		if err := s.crawlers[cmdData.ID].Command(cmdData.Cmd); err != nil {